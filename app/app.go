@@ -1,8 +1,10 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -10,6 +12,7 @@ import (
 
 	"github.com/kpym/lol/builder"
 	"github.com/kpym/lol/log"
+	"github.com/kpym/lol/texdeps"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
@@ -26,6 +29,17 @@ const (
 
 	// If the main file is piped to stdin, this name is used.
 	MainNameIfStdin = "main_from_stdin.tex"
+
+	// The service used when none is specified (and it supports the requested options).
+	defaultService = "laton"
+)
+
+// The commands that can be given as first argument.
+const (
+	// SubmitCommand submits the build and prints its id.
+	SubmitCommand = "submit"
+	// FetchCommand waits for a submitted build (by id) and saves its pdf.
+	FetchCommand = "fetch"
 )
 
 // The version that is set by goreleaser
@@ -36,34 +50,102 @@ func Help() {
 	var out = os.Stderr
 	fmt.Fprintf(out, "lol (version: %s)\n", version)
 	fmt.Fprintln(out, "LaTeX online compiler. More info at www.github.com/kpym/lol.")
+	fmt.Fprintln(out, "\nUsage:")
+	fmt.Fprintln(out, "  lol [options] [main.tex] [files...]         build the pdf")
+	fmt.Fprintln(out, "  lol submit [options] [main.tex] [files...]  submit the build and print its id")
+	fmt.Fprintln(out, "  lol fetch [options] <id>                    wait for a submitted build and save the pdf")
 	fmt.Fprintln(out, "\nAvailable options:")
 	pflag.PrintDefaults()
 
+	fmt.Fprintln(out, "\nAvailable services:")
+	for _, s := range builder.Services() {
+		if s.Url != "" {
+			fmt.Fprintf(out, "  %-10s %s (%s)\n", s.Name, s.Url, s.Description)
+		} else {
+			fmt.Fprintf(out, "  %-10s %s\n", s.Name, s.Description)
+		}
+		fmt.Fprintf(out, "  %-10s compilers: %s\n", "", strings.Join(s.Compilers, ", "))
+		if len(s.Biblios) > 0 {
+			fmt.Fprintf(out, "  %-10s biblio: %s\n", "", strings.Join(s.Biblios, ", "))
+		}
+	}
+
 	fmt.Fprintln(out, "\nExamples:")
 	fmt.Fprintln(out, "> lol main.tex")
 	fmt.Fprintln(out, "> lol  -s ytotech -c xelatex main.tex")
 	fmt.Fprintln(out, "> lol main.tex personal.sty images/img*.pdf")
 	fmt.Fprintln(out, "> cat main.tex | lol -c lualatex -o out.pdf")
+	fmt.Fprintln(out, "> lol submit -s ytotech main.tex")
+	fmt.Fprintln(out, "> lol fetch -s ytotech -o main.pdf <id>")
+	fmt.Fprintln(out, "> lol --git https://github.com/user/paper --target paper.tex")
+	fmt.Fprintln(out, "> lol --url-source https://example.com/paper.tex")
 	fmt.Fprintln(out, "")
 }
 
 // InitFlag define the CLI flags.
 func InitFlags() {
-	pflag.StringP("service", "s", "", "Service can be laton or ytotex.")
+	var compilers, biblios []string
+	for _, s := range builder.Services() {
+		compilers = appendNew(compilers, s.Compilers...)
+		biblios = appendNew(biblios, s.Biblios...)
+	}
+	pflag.StringP("service", "s", "", "Service can be "+joinOr(builder.Names())+".\nIf empty, the fastest healthy service is used.")
+	pflag.StringSlice("services", nil, "Ordered list of services to try if the previous one is down (like laton,ytotech).\nIgnored if --service is set.")
+	pflag.Bool("race", false, "Send the request to all compatible services (or --services) at once and keep the first pdf.\nIgnored if --service is set.")
 	pflag.String("url", "", "The base url for the service. If empty, the default URL is used.")
-	pflag.StringP("compiler", "c", "pdflatex", "One of pdflatex,xelatex or lualatex.\nFor ytotex platex, uplatex and context are also available.\n")
+	pflag.StringP("compiler", "c", "pdflatex", "One of "+joinOr(compilers)+",\nor auto to infer it (and the bibliography) from the main file.\nNot all services support all compilers (see below).\n")
 	pflag.BoolP("force", "f", false, "Do not use the laton cache. Force compile. Ignored by ytotech.")
-	pflag.StringP("biblio", "b", "", "Can be bibtex or biber for ytotex. Not used by laton.")
+	pflag.StringP("biblio", "b", "", "Can be "+joinOr(biblios)+". Not supported by all services (see below).")
+	pflag.Bool("halt-on-error", false, "Stop the compilation at the first error. Only for ytotech.")
+	pflag.Bool("log-files", false, "Ask for all log files in case of error. Only for ytotech.")
+	pflag.Bool("resource-cache", false, "Send the files already uploaded by hash (the server keeps them in cache). Only for ytotech.")
 	pflag.StringP("output", "o", "", "The name of the pdf file. If empty, same as the main tex file.")
 	pflag.StringP("main", "m", "", "The main tex file to compile.")
+	pflag.BoolP("deps", "d", false, "Add the local files used by the main tex file (\\input, \\includegraphics, \\bibliography, ...).")
+	pflag.StringSlice("exclude", nil, "Do not send the files matching these rules (in gitignore syntax, like *.pdf,build/),\nadded to the rules of the .lolignore file and to the default ones (*.aux, *.log, ...).")
+	pflag.BoolP("recursive", "r", false, "Send also the files in the subfolders of the folders given as patterns.\nPatterns with ** (like figs/**/*.pdf) match any number of folders.")
+	pflag.Bool("gitignore", false, "Do not send the files excluded by the .gitignore file (of the current folder).")
+	pflag.String("git", "", "Compile from this git repository (cloned by the service) instead of uploading the files.\nOnly for services that support it (laton).")
+	pflag.String("branch", "", "The git branch to compile. If empty, the default branch is used.")
+	pflag.String("target", "", "The main tex file in the git repository (same as --main).")
+	pflag.String("url-source", "", "Compile the main tex file downloaded by the service from this public url.\nOnly for services that support it (laton, ytotech).")
+	pflag.Bool("async", false, "Submit the build and poll its status, instead of waiting for the answer.\nOnly for services with asynchronous builds (ytotech).")
+	pflag.DurationP("timeout", "t", 0, "Abort the build after this duration (like 30s or 2m). No timeout if 0.")
+	pflag.Int("max-size", 0, "Abort if the pdf (or a remote file) is bigger than this size (in MB). No limit if 0.")
+	pflag.String("proxy", "", "The proxy url. If empty, the HTTP_PROXY and HTTPS_PROXY environment variables are used.")
+	pflag.String("ca-file", "", "A file with extra CA certificates (PEM) to trust.")
+	pflag.String("cert", "", "The client certificate file (PEM), to authenticate with --key.")
+	pflag.String("key", "", "The private key file (PEM) of the client certificate.")
+	pflag.Bool("insecure", false, "Do not verify the server certificate. Use only for testing.")
+	pflag.String("credentials", "", "A file (readable only by you) with the credentials for the services.\nIf empty, lol/credentials.yaml in the user config folder is used (if present).")
+	pflag.Duration("connect-timeout", 0, "Abort if the connection to the service is not established after this duration.\nIf 0, 30s is used.")
 	pflag.BoolP("quiet", "q", false, "Prevent any output.")
-	pflag.BoolP("verbose", "v", false, "Print info and errors. No debug info is printed.")
-	pflag.Bool("debug", false, "Print everithing (debug info included).")
+	pflag.BoolP("verbose", "v", false, "Print info and errors (and the log warnings). No debug info is printed.")
+	pflag.Bool("debug", false, "Print everithing (debug info and full compilation log included).")
 	pflag.Parse()
 }
 
+// appendNew appends the values that are not already in list.
+// Used in InitFlags only.
+func appendNew(list []string, values ...string) []string {
+	for _, v := range values {
+		if !stringIn(v, list...) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// joinOr joins the values like "a, b or c".
+// Used in InitFlags only.
+func joinOr(values []string) string {
+	if len(values) < 2 {
+		return strings.Join(values, "")
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
+
 // stringsIn checks if the first argument is equal to one of the following parameters.
-// Used in GetParameters only.
 func stringIn(str string, values ...string) bool {
 	for _, v := range values {
 		if str == v {
@@ -73,8 +155,143 @@ func stringIn(str string, values ...string) bool {
 	return false
 }
 
+// chooseService returns the service to use when none is specified.
+// If candidates is not empty, the first candidate that supports the compiler and the biblio is chosen.
+// Otherwise the default service is preferred, if it supports the compiler and the biblio,
+// and the explicit services are never chosen.
+func chooseService(compiler, biblio string, candidates ...string) (builder.Service, error) {
+	if len(candidates) == 0 {
+		if s, ok := builder.Lookup(defaultService); ok && s.Supports(compiler, biblio) == nil {
+			return s, nil
+		}
+	}
+	services, err := lookupServices(candidates)
+	if err != nil {
+		return builder.Service{}, err
+	}
+	return selectService(services, compiler, biblio)
+}
+
+// selectService returns the first of the services that supports the compiler and the biblio.
+func selectService(services []builder.Service, compiler, biblio string) (builder.Service, error) {
+	var compilerOk bool
+	for _, s := range services {
+		if s.Supports(compiler, biblio) == nil {
+			return s, nil
+		}
+		compilerOk = compilerOk || s.Supports(compiler, "") == nil
+	}
+	if !compilerOk {
+		return builder.Service{}, fmt.Errorf("Non supported %s compiler.", compiler)
+	}
+	return builder.Service{}, fmt.Errorf("No service supports %s compiler with %s bibliography.", compiler, biblio)
+}
+
+// lookupServices returns the registered services with these names.
+// If names is empty all services that are not explicit are returned.
+func lookupServices(names []string) ([]builder.Service, error) {
+	if len(names) == 0 {
+		var services []builder.Service
+		for _, s := range builder.Services() {
+			if !s.Explicit {
+				services = append(services, s)
+			}
+		}
+		return services, nil
+	}
+	services := make([]builder.Service, 0, len(names))
+	for _, name := range names {
+		s, ok := builder.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown %s service.", name)
+		}
+		services = append(services, s)
+	}
+	return services, nil
+}
+
+// NewBuilder returns the Builder for params.Service,
+// or a race Builder if params.Race is set,
+// or a failover Builder if several params.Services are provided.
+func NewBuilder(params builder.Parameters) (builder.Builder, error) {
+	if params.Race {
+		services, err := lookupServices(params.Services)
+		if err != nil {
+			return nil, err
+		}
+		return builder.NewRace(services...), nil
+	}
+	if len(params.Services) < 2 {
+		return builder.New(params.Service)
+	}
+	services, err := lookupServices(params.Services)
+	if err != nil {
+		return nil, err
+	}
+	return builder.NewFailover(services...), nil
+}
+
+// GetCommand returns the command (if any) and the remaining arguments.
+func GetCommand() (string, []string) {
+	args := pflag.Args()
+	if len(args) > 0 && stringIn(args[0], SubmitCommand, FetchCommand) {
+		return args[0], args[1:]
+	}
+	return "", args
+}
+
+// asyncOnly returns the names of the services with asynchronous builds (in the same order).
+// The unknown services are skipped.
+func asyncOnly(names []string) []string {
+	var async []string
+	for _, name := range names {
+		s, ok := builder.Lookup(strings.ToLower(name))
+		if !ok {
+			continue
+		}
+		if _, ok := s.New().(builder.AsyncBuilder); ok {
+			async = append(async, s.Name)
+		}
+	}
+	return async
+}
+
+// asyncServices returns the names of the services with asynchronous builds.
+func asyncServices() []string {
+	var names []string
+	for _, s := range builder.Services() {
+		if _, ok := s.New().(builder.AsyncBuilder); ok && !s.Explicit {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// sourceServices returns the names of the services supporting this kind of Source.
+func sourceServices(kind string) []string {
+	var names []string
+	for _, s := range builder.Services() {
+		if stringIn(kind, s.Sources...) && !s.Explicit {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// GetSource returns the Source of the request, or nil if the files are uploaded.
+func GetSource(params builder.Parameters) builder.Source {
+	switch {
+	case params.Git != "":
+		return &builder.GitSource{Repo: params.Git, Branch: params.Branch}
+	case params.UrlSource != "":
+		return &builder.URLSource{Url: params.UrlSource}
+	}
+	return nil
+}
+
 // GetParameters use pflag and viper to set the parameters.
-func GetParameters(params *builder.Parameters) error {
+// The probes of the automatic service selection are aborted when ctx is done.
+func GetParameters(ctx context.Context, params *builder.Parameters) error {
 	v := viper.New()
 
 	// Bind the current command's flags to viper
@@ -100,9 +317,13 @@ func GetParameters(params *builder.Parameters) error {
 	v.SetEnvPrefix(envPrefix)
 
 	// Bind to environment variables.
-	// I we have --compsed-flags we can use :
-	// v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	// The --composed-flags are bound to $LOL_COMPOSED_FLAGS.
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	v.AutomaticEnv()
+	// The credentials can be provided only by config file or environment variables (not by flags).
+	v.BindEnv("token")
+	v.BindEnv("user")
+	v.BindEnv("password")
 
 	// Transfer the parameters values to params struct.
 	err := v.Unmarshal(params)
@@ -124,40 +345,160 @@ func GetParameters(params *builder.Parameters) error {
 	// the default writer is os.Stdout (color.Output)
 	params.Log = log.New(log.WithLevel(level), log.WithColor())
 
-	// normalise the service name
-	params.Service = strings.ToLower(params.Service)
-	// chack if the service support the requested options
-	if !stringIn(params.Service, "laton", "ytotech", "") {
-		return fmt.Errorf("Unknown %s service.", params.Service)
+	// the submit and fetch commands need a single asynchronous service
+	command, args := GetCommand()
+	if command != "" {
+		params.Async = true
+		params.Race = false
+		if params.Service == "" && len(params.Services) == 0 {
+			params.Services = asyncServices()
+		} else if params.Service == "" {
+			services := asyncOnly(params.Services)
+			if len(services) == 0 {
+				return fmt.Errorf("None of the %s services can do asynchronous builds (needed by %s).", strings.Join(params.Services, ", "), command)
+			}
+			if len(services) < len(params.Services) {
+				params.Log.Info("Only the %s services can do asynchronous builds (needed by %s).", strings.Join(services, ", "), command)
+			}
+			params.Services = services
+		}
+	}
+
+	// the main file in the git repository
+	if params.Main == "" {
+		params.Main = v.GetString("target")
+	}
+	if params.Git == "" && params.Branch != "" {
+		return fmt.Errorf("The --branch flag needs a --git repository.")
+	}
+	if params.Git != "" && params.UrlSource != "" {
+		return fmt.Errorf("The --git and --url-source flags can't be used together.")
 	}
-	if stringIn(params.Compiler, "platex", "uplatex", "context") {
-		if params.Service == "laton" {
-			return fmt.Errorf("Laton do not support %s compiler.", params.Compiler)
+	// the main file from an url is named after it
+	if params.UrlSource != "" && params.Main == "" {
+		u, err := url.Parse(params.UrlSource)
+		if err != nil {
+			return fmt.Errorf("Bad url source: %w", err)
 		}
-		if params.Service == "" {
-			params.Service = "ytotech"
+		params.Main = path.Base(u.Path)
+		if !strings.HasSuffix(params.Main, ".tex") {
+			params.Main = "main.tex"
 		}
-	} else if !stringIn(params.Compiler, "pdflatex", "xelatex", "lualatex") {
-		return fmt.Errorf("Non supported %s compiler.", params.Compiler)
 	}
-	if params.Biblio != "" {
-		if params.Service == "laton" {
-			return fmt.Errorf("Laton do not support %s bibliography.", params.Biblio)
-		}
-		if params.Service == "" {
-			params.Service = "ytotech"
+	// a git repository (or an url) is compiled only by the services that can fetch it
+	if source := GetSource(*params); source != nil && params.Service == "" && len(params.Services) == 0 {
+		params.Services = sourceServices(source.Kind())
+	}
+
+	// the magic comments (% !TEX program = xelatex) of the main file
+	var rooted bool
+	if GetSource(*params) == nil && command != FetchCommand {
+		rooted, err = setMagic(v, params, args)
+		if err != nil {
+			return err
 		}
 	}
+
+	// the compiler inferred from the main file
+	if params.Compiler == autoCompiler {
+		setAutoCompiler(params, mainFile(*params, args), v.IsSet("biblio"))
+	}
+
+	// normalise the service name
+	params.Service = strings.ToLower(params.Service)
+	// check if the service support the requested options
+	var service builder.Service
 	if params.Service == "" {
-		// TODO : choose the fastest ?
-		params.Service = "laton"
+		for i := range params.Services {
+			params.Services[i] = strings.ToLower(params.Services[i])
+		}
+		var ok bool
+		// with a failover list the services are tried in the given order
+		if params.Url == "" && !params.Race && command == "" && len(params.Services) < 2 {
+			service, ok, err = autoService(ctx, params)
+			if err != nil {
+				return err
+			}
+		}
+		if !ok {
+			service, err = chooseService(params.Compiler, params.Biblio, params.Services...)
+			if err != nil {
+				return err
+			}
+		}
+		params.Service = service.Name
+	} else {
+		// an explicit service disables the failover and the race
+		params.Services = nil
+		if params.Race {
+			params.Log.Info("The race mode is ignored because the %s service is set.", params.Service)
+			params.Race = false
+		}
+		var ok bool
+		service, ok = builder.Lookup(params.Service)
+		if !ok {
+			return fmt.Errorf("Unknown %s service.", params.Service)
+		}
+	}
+	err = service.Accepts(builder.Request{Parameters: *params, Source: GetSource(*params)})
+	if err != nil {
+		return err
 	}
 	if params.Url == "" {
-		switch params.Service {
-		case "laton":
-			params.Url = "https://texlive2020.latexonline.cc"
-		case "ytotech":
-			params.Url = "https://latex.ytotech.com"
+		params.Url = service.Url
+	}
+	// the credentials for the services
+	err = setAuth(v, params)
+	if err != nil {
+		return err
+	}
+	// check the http client configuration
+	_, err = builder.NewClient(*params)
+	if err != nil {
+		return err
+	}
+	if params.Insecure {
+		params.Log.Info("The server certificates are not verified (--insecure).")
+	}
+	if _, ok := service.New().(builder.AsyncBuilder); params.Async && !ok {
+		if command != "" {
+			return fmt.Errorf("The %s service can't do asynchronous builds.", service.Name)
+		}
+		params.Log.Info("The %s service can't do asynchronous builds, --async is ignored.", service.Name)
+		params.Async = false
+	}
+	if command != "" {
+		params.Services = nil
+	}
+	if command == FetchCommand {
+		if len(args) != 1 {
+			return fmt.Errorf("The fetch command needs a single build id.")
+		}
+		if params.Output == "" {
+			params.Output = args[0] + ".pdf"
+		}
+		return nil
+	}
+	// the sources are fetched by the service, nothing to upload
+	if source := GetSource(*params); source != nil {
+		if len(args) > 0 || len(params.Patterns) > 0 {
+			return fmt.Errorf("Files can't be sent with a %s source.", source.Kind())
+		}
+		if params.Main == "" {
+			return fmt.Errorf("Missing --target file to compile in the git repository.")
+		}
+		if len(params.Remote) > 0 && params.Git != "" {
+			params.Log.Info("The remote files are ignored with a git repository.")
+		}
+		if params.Output == "" {
+			params.Output = strings.TrimSuffix(path.Base(params.Main), ".tex") + ".pdf"
+		}
+		return nil
+	}
+	// check the remote files
+	for _, r := range params.Remote {
+		if r.Path == "" || r.Url == "" {
+			return fmt.Errorf("Remote files need both path and url (got path %q and url %q).", r.Path, r.Url)
 		}
 	}
 	// check if the input is piped
@@ -167,7 +508,7 @@ func GetParameters(params *builder.Parameters) error {
 		params.Log.Debug("Piped input: %v, Stdin mode: %v.", params.PipedMain, fi.Mode())
 	}
 	// get the patterns
-	params.Patterns = append(pflag.Args(), params.Patterns...)
+	params.Patterns = append(args, params.Patterns...)
 	if len(params.Patterns) == 0 && params.Main == "" && !params.PipedMain {
 		return fmt.Errorf("Missing file to compile.")
 	}
@@ -182,10 +523,17 @@ func GetParameters(params *builder.Parameters) error {
 	} else {
 		params.Patterns = append([]string{params.Main}, params.Patterns...)
 	}
+	// the files are sent relative to the folder of a magic root
+	if rooted {
+		err = setRoot(params)
+		if err != nil {
+			return err
+		}
+	}
 
 	// set the output (if not piped input)
 	if params.Output == "" && params.Main != "" {
-		params.Output = strings.TrimSuffix(params.Main, ".tex") + ".pdf"
+		params.Output = strings.TrimSuffix(rootPath(*params, params.Main), ".tex") + ".pdf"
 	}
 
 	// set Main if piped input
@@ -197,6 +545,7 @@ func GetParameters(params *builder.Parameters) error {
 }
 
 // GetFiles read all files based on params.Patterns.
+// The files are read from params.Root (if set) and named relative to it.
 func GetFiles(params builder.Parameters) (builder.Files, error) {
 	// temporary variables
 	var (
@@ -210,23 +559,31 @@ func GetFiles(params builder.Parameters) (builder.Files, error) {
 		params.Log.Debug("Read the main file from stdin.")
 		filedata, err = io.ReadAll(os.Stdin)
 	} else {
-		params.Log.Debug("Read the main file from %s.", params.Main)
-		filedata, err = os.ReadFile(params.Main)
+		params.Log.Debug("Read the main file from %s.", rootPath(params, params.Main))
+		filedata, err = os.ReadFile(rootPath(params, params.Main))
 	}
 	files[params.Main] = filedata
 	if err != nil {
 		return nil, fmt.Errorf("Error while reading the main file: %w", err)
 	}
+	// get the files used by the main file
+	if params.Deps {
+		addDeps(params, files, filedata)
+	}
+	// the files to exclude
+	exclude, err := excludeMatcher(params)
+	if err != nil {
+		return nil, err
+	}
 	// get all other files (if any) that are readable
 	for _, pat := range params.Patterns {
 		// check if is folder or pattern
-		patInfo, err := os.Stat(pat)
-		if err == nil {
-			if patInfo.IsDir() {
-				pat = path.Join(pat, "*")
-			}
+		// (the excluded files are skipped, unless explicitly named)
+		explicit := !strings.ContainsAny(pat, "*?[")
+		if patInfo, err := os.Stat(rootPath(params, pat)); err == nil && patInfo.IsDir() {
+			explicit = false
 		}
-		names, _ := filepath.Glob(pat)
+		names := expand(params, pat, exclude)
 		for _, fname := range names {
 			// if on Windows, transform to unix name
 			uname := filepath.ToSlash(fname)
@@ -234,8 +591,13 @@ func GetFiles(params builder.Parameters) (builder.Files, error) {
 			if _, ok := files[uname]; ok {
 				continue
 			}
+			// if this file is excluded
+			if !explicit && exclude.Match(uname, false) {
+				params.Log.Debug("File %s excluded.", uname)
+				continue
+			}
 			// read the file, or skipt it if not readable
-			filedata, err = os.ReadFile(fname)
+			filedata, err = os.ReadFile(rootPath(params, fname))
 			if err == nil {
 				files[uname] = filedata
 				params.Log.Debug("File %s (%d bytes) added to the list.", uname, len(filedata))
@@ -247,3 +609,29 @@ func GetFiles(params builder.Parameters) (builder.Files, error) {
 
 	return files, nil
 }
+
+// addDeps adds to files the local files used by the main file (with content filedata).
+// The missing files are only reported.
+func addDeps(params builder.Parameters, files builder.Files, filedata []byte) {
+	dir, main := ".", params.Main
+	if !params.PipedMain {
+		dir, main = filepath.Dir(params.Main), filepath.Base(params.Main)
+	}
+	found, missing := texdeps.Find(os.DirFS(rootPath(params, dir)), main, filedata)
+	for _, name := range found {
+		uname := path.Join(filepath.ToSlash(dir), name)
+		if _, ok := files[uname]; ok {
+			continue
+		}
+		filedata, err := os.ReadFile(rootPath(params, filepath.Join(dir, filepath.FromSlash(name))))
+		if err != nil {
+			params.Log.Debug("Problem reading support file (we skip it): %s.", uname)
+			continue
+		}
+		files[uname] = filedata
+		params.Log.Debug("File %s (%d bytes) used by %s added to the list.", uname, len(filedata), params.Main)
+	}
+	for _, name := range missing {
+		params.Log.Info("The file %s used by %s is not found.", name, params.Main)
+	}
+}
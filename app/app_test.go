@@ -1,10 +1,17 @@
 package app
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/kpym/lol/builder"
+	_ "github.com/kpym/lol/builder/laton"
+	_ "github.com/kpym/lol/builder/ytotech"
 	"github.com/kpym/lol/log"
+	"github.com/spf13/pflag"
 )
 
 func TestGetFiles(t *testing.T) {
@@ -71,3 +78,115 @@ func TestGetFiles(t *testing.T) {
 		}
 	}
 }
+
+func TestSelectService(t *testing.T) {
+	// the services are not registered, so the tests don't depend on the registry
+	services := []builder.Service{
+		{
+			Name:      "fake-tex",
+			Compilers: []string{"pdflatex", "xelatex"},
+		},
+		{
+			Name:      "fake-jp",
+			Compilers: []string{"pdflatex", "platex"},
+			Biblios:   []string{"biber"},
+		},
+	}
+
+	testData := []struct {
+		compiler, biblio string
+		service          string
+	}{
+		{"pdflatex", "", "fake-tex"},
+		{"xelatex", "", "fake-tex"},
+		{"platex", "", "fake-jp"},
+		{"pdflatex", "biber", "fake-jp"},
+		{"xelatex", "biber", ""},
+		{"context", "", ""},
+	}
+	for _, check := range testData {
+		s, err := selectService(services, check.compiler, check.biblio)
+		if check.service == "" {
+			if err == nil {
+				t.Errorf("No service should support %s with %q, but got %s.", check.compiler, check.biblio, s.Name)
+			}
+			continue
+		}
+		if err != nil || s.Name != check.service {
+			t.Errorf("For %s with %q expected %s, got %s (error: %v).", check.compiler, check.biblio, check.service, s.Name, err)
+		}
+	}
+}
+
+// writeTree writes the files (unix names with their content) in a temporary folder,
+// and makes it the current folder until the end of the test.
+// It returns the folder.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for fname, content := range files {
+		fname = filepath.Join(dir, filepath.FromSlash(fname))
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// parseArgs parses the command line arguments (without the program name) with fresh flags,
+// until the end of the test.
+func parseArgs(t *testing.T, args ...string) {
+	t.Helper()
+	flags := pflag.CommandLine
+	osArgs := os.Args
+	t.Cleanup(func() {
+		pflag.CommandLine = flags
+		os.Args = osArgs
+	})
+	pflag.CommandLine = pflag.NewFlagSet("lol", pflag.ContinueOnError)
+	os.Args = append([]string{"lol"}, args...)
+	InitFlags()
+}
+
+func TestAsyncServices(t *testing.T) {
+	writeTree(t, map[string]string{"main.tex": "\\documentclass{article}\n"})
+	tests := []struct {
+		args    []string
+		service string
+		err     bool
+	}{
+		{[]string{"submit", "main.tex"}, "ytotech", false},
+		{[]string{"submit", "--services", "laton,YTOTECH", "main.tex"}, "ytotech", false},
+		{[]string{"fetch", "--services", "laton,ytotech", "build-id"}, "ytotech", false},
+		{[]string{"submit", "--services", "laton", "main.tex"}, "", true},
+	}
+	for _, test := range tests {
+		parseArgs(t, append([]string{"--quiet"}, test.args...)...)
+		var params builder.Parameters
+		err := GetParameters(context.Background(), &params)
+		if test.err {
+			if err == nil {
+				t.Errorf("lol %s should fail.", strings.Join(test.args, " "))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for lol %s: %v", strings.Join(test.args, " "), err)
+			continue
+		}
+		if params.Service != test.service {
+			t.Errorf("Wrong service for lol %s: %q, expected %q.", strings.Join(test.args, " "), params.Service, test.service)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/kpym/lol/builder"
+	"github.com/spf13/viper"
+)
+
+// credentialsFile returns the path of the default credentials file.
+func credentialsFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lol", "credentials.yaml"), nil
+}
+
+// loadCredentials reads the Auth list of the credentials file.
+// The file should not be accessible by the group and the others.
+func loadCredentials(fname string) ([]builder.Auth, error) {
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("The credentials file %s should be readable only by you (chmod 600 %s).", fname, fname)
+	}
+	v := viper.New()
+	v.SetConfigFile(fname)
+	err = v.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Can't read the credentials file: %w", err)
+	}
+	var auths []builder.Auth
+	err = v.UnmarshalKey("auth", &auths)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read the credentials file: %w", err)
+	}
+	return auths, nil
+}
+
+// setAuth completes params.Auth (from the config file) with:
+// - the token, user and password from $LOL_TOKEN, $LOL_USER and $LOL_PASSWORD,
+// used for params.Url (they take precedence),
+// - the credentials file (the default one is ignored if missing).
+func setAuth(v *viper.Viper, params *builder.Parameters) error {
+	token, user := v.GetString("token"), v.GetString("user")
+	if token != "" || user != "" {
+		a := builder.Auth{Url: params.Url, Token: token, User: user, Password: v.GetString("password")}
+		params.Auth = append([]builder.Auth{a}, params.Auth...)
+	}
+	fname := v.GetString("credentials")
+	explicit := fname != ""
+	if !explicit {
+		var err error
+		fname, err = credentialsFile()
+		if err != nil {
+			return nil
+		}
+	}
+	auths, err := loadCredentials(fname)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	params.Log.Debug("Credentials read from %s.", fname)
+	params.Auth = append(params.Auth, auths...)
+	return nil
+}
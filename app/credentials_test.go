@@ -0,0 +1,37 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLoadCredentials(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "credentials.yaml")
+	data := []byte("auth:\n  - url: https://latex.example.com\n    token: secret\n    headers:\n      X-Team: tex\n")
+	err := os.WriteFile(fname, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auths, err := loadCredentials(fname)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(auths) != 1 || auths[0].Url != "https://latex.example.com" || auths[0].Token != "secret" || auths[0].Headers["x-team"] != "tex" {
+		t.Errorf("Wrong credentials: %+v", auths)
+	}
+
+	// the file should be private
+	if runtime.GOOS == "windows" {
+		return
+	}
+	err = os.Chmod(fname, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadCredentials(fname)
+	if err == nil {
+		t.Errorf("A credentials file readable by others should be refused.")
+	}
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/ignore"
+)
+
+// the ignore files (in the folder of the sent files, see params.Root)
+const (
+	lolIgnoreFile = ".lolignore"
+	gitIgnoreFile = ".gitignore"
+)
+
+// defaultExcludes are the TeX build artifacts and the editor backups,
+// never sent when a folder or a glob pattern is used.
+// They can be re-included with !rule in .lolignore or in Exclude.
+var defaultExcludes = []string{
+	"*.aux", "*.log", "*.out", "*.toc", "*.lof", "*.lot", "*.blg", "*.bcf", "*.run.xml",
+	"*.fls", "*.fdb_latexmk", "*.synctex", "*.synctex.gz", "*.synctex(busy)",
+	"*.idx", "*.ilg", "*.ind", "*.nav", "*.snm", "*.vrb", "*.dvi", "*.xdv",
+	"*~", "*.bak", "*.swp", "#*#", ".DS_Store", ".git/", lolIgnoreFile, gitIgnoreFile,
+}
+
+// excludeMatcher returns the rules (in gitignore syntax) of the files to exclude:
+// the defaults, the output pdf, the .lolignore file,
+// the .gitignore file (if params.GitIgnore is set) and params.Exclude (in this order).
+// The ignore files are read from params.Root (if set).
+func excludeMatcher(params builder.Parameters) (*ignore.Matcher, error) {
+	m := ignore.New(defaultExcludes...)
+	if params.Output != "" {
+		m.Add(ignore.Escape(filepath.ToSlash(rootName(params, params.Output))))
+	}
+	fnames := []string{lolIgnoreFile}
+	if params.GitIgnore {
+		fnames = append(fnames, gitIgnoreFile)
+	}
+	for _, fname := range fnames {
+		err := m.AddFile(rootPath(params, fname))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Can't read the %s file: %w", fname, err)
+		}
+		params.Log.Debug("Exclusion rules read from %s.", fname)
+	}
+	m.Add(params.Exclude...)
+	return m, nil
+}
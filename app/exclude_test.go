@@ -0,0 +1,50 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/log"
+)
+
+func TestGetFilesExclude(t *testing.T) {
+	writeTree(t, map[string]string{
+		"main.tex":           "\\documentclass{article}",
+		"main.aux":           "aux",
+		"main.pdf":           "old pdf",
+		"refs.bib":           "@book{}",
+		"notes.txt":          "notes",
+		"figs/a.pdf":         "pdf",
+		"figs/a.svg":         "svg",
+		"figs/main.log":      "log",
+		".lolignore":         "*.svg\n",
+		".gitignore":         "notes.txt\n",
+		"build/keep.tex":     "tex",
+		"build/old/main.tex": "tex",
+	})
+
+	params := builder.Parameters{
+		Log:       log.New(log.WithLevel(log.Quiet)),
+		Main:      "main.tex",
+		Output:    "main.pdf",
+		Patterns:  []string{"main.tex", ".", "figs", "build/*", "figs/main.log"},
+		Exclude:   []string{"build/"},
+		GitIgnore: true,
+	}
+	files, err := GetFiles(params)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// figs/main.log is explicitly named
+	expected := "[figs/a.pdf figs/main.log main.tex refs.bib]"
+	if fmt.Sprint(names) != expected {
+		t.Errorf("Wrong files: %v instead of %v", names, expected)
+	}
+}
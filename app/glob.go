@@ -0,0 +1,139 @@
+package app
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/ignore"
+)
+
+// maxDepth is the maximal number of folder levels read by the recursive patterns.
+const maxDepth = 20
+
+// expand returns the names of the files matching the pattern:
+// - a folder gives its files (and the files of its subfolders if params.Recursive is set),
+// - a pattern with ** (like figs/**/*.pdf) matches any number of folders,
+// - any other pattern is used with filepath.Glob.
+// The excluded folders are not read.
+// The pattern and the names are relative to params.Root (if set).
+func expand(params builder.Parameters, pat string, exclude *ignore.Matcher) []string {
+	if info, err := os.Stat(rootPath(params, pat)); err == nil && info.IsDir() {
+		if params.Recursive {
+			return walk(params, pat, exclude)
+		}
+		pat = path.Join(pat, "*")
+	}
+	if !strings.Contains(pat, "**") {
+		names, _ := filepath.Glob(rootPath(params, pat))
+		// the matching folders are skipped, or read recursively
+		var files []string
+		for _, fname := range names {
+			name := rootName(params, fname)
+			info, err := os.Stat(fname)
+			switch {
+			case err == nil && !info.IsDir():
+				files = append(files, name)
+			case err == nil && params.Recursive && !exclude.Match(filepath.ToSlash(name), true):
+				files = append(files, walk(params, name, exclude)...)
+			}
+		}
+		return files
+	}
+	// the folders before the first ** or wildcard are not read
+	segments := strings.Split(path.Clean(filepath.ToSlash(pat)), "/")
+	base := 0
+	for base < len(segments)-1 && !strings.ContainsAny(segments[base], "*?[") {
+		base++
+	}
+	root := strings.Join(segments[:base], "/")
+	if root == "" && strings.HasPrefix(filepath.ToSlash(pat), "/") {
+		root = "/"
+	} else if root == "" {
+		root = "."
+	}
+	var files []string
+	for _, fname := range walk(params, filepath.FromSlash(root), exclude) {
+		if matchSegments(segments, strings.Split(filepath.ToSlash(fname), "/")) {
+			files = append(files, fname)
+		}
+	}
+	return files
+}
+
+// walk returns the files in the folder root and in its subfolders, up to maxDepth levels.
+// The symbolic links are followed, but a folder is never read twice (no loops).
+// The excluded folders are skipped.
+func walk(params builder.Parameters, root string, exclude *ignore.Matcher) []string {
+	var (
+		files   []string
+		visited = make(map[string]bool)
+		read    func(dir string, depth int)
+	)
+	read = func(dir string, depth int) {
+		real, err := filepath.EvalSymlinks(rootPath(params, dir))
+		if err != nil {
+			params.Log.Debug("Problem reading the folder (we skip it): %s.", dir)
+			return
+		}
+		if abs, err := filepath.Abs(real); err == nil {
+			real = abs
+		}
+		if visited[real] {
+			params.Log.Debug("Folder %s already read (symbolic link loop?).", dir)
+			return
+		}
+		visited[real] = true
+		entries, err := os.ReadDir(rootPath(params, dir))
+		if err != nil {
+			params.Log.Debug("Problem reading the folder (we skip it): %s.", dir)
+			return
+		}
+		for _, entry := range entries {
+			name := filepath.Join(dir, entry.Name())
+			// follow the symbolic links
+			info, err := os.Stat(rootPath(params, name))
+			if err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				files = append(files, name)
+				continue
+			}
+			if exclude.Match(filepath.ToSlash(name), true) {
+				params.Log.Debug("Folder %s excluded.", filepath.ToSlash(name))
+				continue
+			}
+			if depth >= maxDepth {
+				params.Log.Info("The folder %s is more than %d levels deep (we skip it).", filepath.ToSlash(name), maxDepth)
+				continue
+			}
+			read(name, depth+1)
+		}
+	}
+	read(root, 0)
+	return files
+}
+
+// matchSegments checks if the name segments match the pattern segments,
+// where ** matches any number of segments.
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchSegments(pattern[1:], name[1:])
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/ignore"
+	"github.com/kpym/lol/log"
+)
+
+func TestExpand(t *testing.T) {
+	writeTree(t, map[string]string{
+		"main.tex":           "",
+		"figs/a.pdf":         "",
+		"figs/ch1/b.pdf":     "",
+		"figs/ch1/c.png":     "",
+		"figs/ch1/ch2/d.pdf": "",
+		"figs/tmp/e.pdf":     "",
+	})
+	// a symbolic link loop
+	if err := os.Symlink("..", filepath.Join("figs", "ch1", "up")); err != nil {
+		t.Logf("No symbolic link: %v", err)
+	}
+
+	exclude := ignore.New("tmp/")
+	params := builder.Parameters{Log: log.New(log.WithLevel(log.Quiet))}
+	tests := []struct {
+		pattern   string
+		recursive bool
+		expected  string
+	}{
+		{"figs", false, "[figs/a.pdf]"},
+		{"figs", true, "[figs/a.pdf figs/ch1/b.pdf figs/ch1/c.png figs/ch1/ch2/d.pdf]"},
+		{"fig*", true, "[figs/a.pdf figs/ch1/b.pdf figs/ch1/c.png figs/ch1/ch2/d.pdf]"},
+		{"figs/**/*.pdf", false, "[figs/a.pdf figs/ch1/b.pdf figs/ch1/ch2/d.pdf]"},
+		{"**/ch1/*", false, "[figs/ch1/b.pdf figs/ch1/c.png]"},
+		{"./figs/*/**/*.pdf", false, "[figs/ch1/b.pdf figs/ch1/ch2/d.pdf]"},
+		{"*.tex", false, "[main.tex]"},
+	}
+	for _, test := range tests {
+		params.Recursive = test.recursive
+		var names []string
+		for _, name := range expand(params, test.pattern, exclude) {
+			names = append(names, filepath.ToSlash(name))
+		}
+		sort.Strings(names)
+		if fmt.Sprint(names) != test.expected {
+			t.Errorf("Wrong files for %q (recursive: %v):\n%v\nexpected:\n%v", test.pattern, test.recursive, names, test.expected)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/log"
+)
+
+// health constants
+const (
+	// The probes older than this are refreshed.
+	probeTTL = 30 * time.Minute
+	// A probe that takes longer than this is a failure.
+	probeTimeout = 3 * time.Second
+	// The weight of the last probe in the latency and success rate averages.
+	probeWeight = 0.3
+	// A service with a lower success rate is not healthy.
+	minSuccessRate = 0.5
+)
+
+// health contains the probes statistics of a service.
+type health struct {
+	Url     string        `json:"url"`
+	Checked time.Time     `json:"checked"`
+	LastOk  bool          `json:"last_ok"`
+	Latency time.Duration `json:"latency"`
+	Rate    float64       `json:"success_rate"`
+}
+
+// healthy checks if the service is usable.
+func (h *health) healthy() bool {
+	return h.LastOk && h.Rate >= minSuccessRate
+}
+
+// update adds the result of a probe to the statistics.
+func (h *health) update(latency time.Duration, ok bool) {
+	first := h.Checked.IsZero()
+	h.Checked = time.Now()
+	h.LastOk = ok
+	success := 0.0
+	if ok {
+		success = 1
+	}
+	if first {
+		h.Rate = success
+	} else {
+		h.Rate = (1-probeWeight)*h.Rate + probeWeight*success
+	}
+	if !ok {
+		return
+	}
+	if h.Latency == 0 {
+		h.Latency = latency
+	} else {
+		h.Latency = time.Duration((1-probeWeight)*float64(h.Latency) + probeWeight*float64(latency))
+	}
+}
+
+// healthCache is the persisted health of all services (by service name).
+type healthCache map[string]*health
+
+// healthFile returns the path of the health cache file.
+func healthFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lol", "health.json"), nil
+}
+
+// loadHealth reads the health cache (an empty cache is returned in case of problem).
+func loadHealth(fname string) healthCache {
+	cache := make(healthCache)
+	data, err := os.ReadFile(fname)
+	if err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+// save writes the health cache.
+func (c healthCache) save(fname string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fname, data, 0644)
+}
+
+// probe measures the time to get an answer from url.
+// Any answer that is not a server error (5xx) is a success.
+func probe(ctx context.Context, client *http.Client, url string) (time.Duration, bool) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return 0, false
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	resp.Body.Close()
+	return time.Since(start), resp.StatusCode < 500
+}
+
+// refresh probes (concurrently) the services that are not in the cache or have old probes.
+// It returns true if at least one service was probed.
+func (c healthCache) refresh(ctx context.Context, client *http.Client, logger log.Logger, services []builder.Service) bool {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	probed := false
+	for _, s := range services {
+		h, ok := c[s.Name]
+		if ok && h.Url == s.Url && time.Since(h.Checked) < probeTTL {
+			continue
+		}
+		if !ok || h.Url != s.Url {
+			h = &health{Url: s.Url}
+			c[s.Name] = h
+		}
+		probed = true
+		wg.Add(1)
+		go func(name string, h *health) {
+			defer wg.Done()
+			latency, ok := probe(ctx, client, h.Url)
+			if ctx.Err() != nil {
+				// an aborted probe says nothing about the service
+				return
+			}
+			logger.Debug("Probe %s: ok=%v in %v.", name, ok, latency)
+			mu.Lock()
+			h.update(latency, ok)
+			mu.Unlock()
+		}(s.Name, h)
+	}
+	wg.Wait()
+	return probed
+}
+
+// best returns the healthy service with the lowest latency (if any).
+func (c healthCache) best(services []builder.Service) (builder.Service, bool) {
+	var (
+		found  bool
+		chosen builder.Service
+		delay  time.Duration
+	)
+	for _, s := range services {
+		h, ok := c[s.Name]
+		if !ok || !h.healthy() {
+			continue
+		}
+		if !found || h.Latency < delay {
+			found, chosen, delay = true, s, h.Latency
+		}
+	}
+	return chosen, found
+}
+
+// autoService chooses the fastest healthy service that supports the compiler and the biblio.
+// The candidates are params.Services if provided or all services that are not explicit.
+// The probes are cached in the user cache folder and refreshed after probeTTL.
+// It returns false if there is nothing to choose or no healthy service.
+// The probes are aborted (with an error) when ctx is done.
+func autoService(ctx context.Context, params *builder.Parameters) (builder.Service, bool, error) {
+	all, err := lookupServices(params.Services)
+	if err != nil {
+		// reported by the service selection without probes
+		params.Log.Debug("No service probes: %v", err)
+		return builder.Service{}, false, nil
+	}
+	var services []builder.Service
+	for _, s := range all {
+		if s.Url != "" && s.Supports(params.Compiler, params.Biblio) == nil {
+			services = append(services, s)
+		}
+	}
+	if len(services) < 2 {
+		return builder.Service{}, false, nil
+	}
+
+	var cache healthCache
+	fname, err := healthFile()
+	if err == nil {
+		cache = loadHealth(fname)
+	} else {
+		cache = make(healthCache)
+	}
+	client, err := builder.NewClient(*params)
+	if err != nil {
+		// reported when the parameters are checked
+		params.Log.Debug("No service probes: %v", err)
+		return builder.Service{}, false, nil
+	}
+	probed := cache.refresh(ctx, client, params.Log, services)
+	if ctx.Err() != nil {
+		return builder.Service{}, false, fmt.Errorf("The service selection was aborted: %w", ctx.Err())
+	}
+	if probed && fname != "" {
+		err = cache.save(fname)
+		if err != nil {
+			params.Log.Debug("Can't save the health cache: %v", err)
+		}
+	}
+	s, ok := cache.best(services)
+	if ok {
+		params.Log.Info("Use %s service (latency %v, success rate %.0f%%).", s.Name, cache[s.Name].Latency.Round(time.Millisecond), 100*cache[s.Name].Rate)
+	}
+	return s, ok, nil
+}
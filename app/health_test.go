@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/log"
+)
+
+func TestHealth(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	services := []builder.Service{
+		{Name: "down", Url: down.URL},
+		{Name: "up", Url: up.URL},
+	}
+
+	cache := make(healthCache)
+	if !cache.refresh(context.Background(), http.DefaultClient, log.New(log.WithLevel(log.Quiet)), services) {
+		t.Errorf("The services should be probed the first time.")
+	}
+	if cache["down"].healthy() || !cache["up"].healthy() {
+		t.Errorf("Wrong health: down=%+v up=%+v", cache["down"], cache["up"])
+	}
+	if s, ok := cache.best(services); !ok || s.Name != "up" {
+		t.Errorf("Expected the up service, got %v.", s.Name)
+	}
+
+	// save and load
+	fname := filepath.Join(t.TempDir(), "health.json")
+	if err := cache.save(fname); err != nil {
+		t.Fatalf("Can't save the cache: %v", err)
+	}
+	cache = loadHealth(fname)
+	if cache.refresh(context.Background(), http.DefaultClient, log.New(log.WithLevel(log.Quiet)), services) {
+		t.Errorf("The probes should not be refreshed before probeTTL.")
+	}
+
+	// the fastest healthy service is chosen
+	cache["down"].update(time.Millisecond, true)
+	cache["down"].update(time.Millisecond, true)
+	cache["up"].Latency = time.Second
+	if s, _ := cache.best(services); s.Name != "down" {
+		t.Errorf("Expected the faster service, got %v.", s.Name)
+	}
+}
+
+func TestHealthCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	services := []builder.Service{{Name: "up", Url: srv.URL}}
+
+	// the aborted probes are not recorded as failures
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cache := make(healthCache)
+	cache.refresh(ctx, http.DefaultClient, log.New(log.WithLevel(log.Quiet)), services)
+	if h := cache["up"]; h != nil && !h.Checked.IsZero() {
+		t.Errorf("An aborted probe should not be recorded: %+v", h)
+	}
+}
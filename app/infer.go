@@ -0,0 +1,142 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/texdeps"
+)
+
+// autoCompiler is the --compiler value asking to infer the compiler from the main file.
+const autoCompiler = "auto"
+
+// defaultCompiler is used when nothing special is found.
+const defaultCompiler = "pdflatex"
+
+// the markers used to infer the compiler and the bibliography
+var (
+	contextRe  = regexp.MustCompile(`\\(starttext|startcomponent|startproduct|setupbodyfont|usemodule|environment)\b`)
+	luaRe      = regexp.MustCompile(`\\(usepackage|RequirePackage)(\[[^\]]*\])?\{[^}]*\b(luacode|luatextra|luaotfload|luacolor|lua-visual-debug)\b[^}]*\}|\\directlua\b`)
+	xetexRe    = regexp.MustCompile(`\\(usepackage|RequirePackage)(\[[^\]]*\])?\{[^}]*\b(xeCJK|mathspec|xltxtra|xunicode)\b[^}]*\}`)
+	fontspecRe = regexp.MustCompile(`\\(usepackage|RequirePackage)(\[[^\]]*\])?\{[^}]*\b(fontspec|unicode-math|polyglossia)\b[^}]*\}`)
+	biblatexRe = regexp.MustCompile(`\\usepackage(\[([^\]]*)\])?\{biblatex\}`)
+	backendRe  = regexp.MustCompile(`backend\s*=\s*(\w+)`)
+	bibtexRe   = regexp.MustCompile(`\\bibliography\{`)
+)
+
+// inference is the result of inferCompiler.
+type inference struct {
+	// the suitable compilers (the first is preferred)
+	compilers []string
+	biblio    string
+	// the reasons of the choice
+	reasons []string
+}
+
+// inferCompiler looks at the content of the main file (the preamble for LaTeX)
+// to find the suitable compilers and the bibliography tool.
+func inferCompiler(content string) inference {
+	var inf inference
+	content = texdeps.StripComments(content)
+	if contextRe.MatchString(content) && !strings.Contains(content, `\documentclass`) {
+		inf.compilers = []string{"context"}
+		inf.reasons = append(inf.reasons, fmt.Sprintf("the ConTeXt command %s", contextRe.FindString(content)))
+		return inf
+	}
+	preamble := content
+	if i := strings.Index(content, `\begin{document}`); i >= 0 {
+		preamble = content[:i]
+	}
+	switch {
+	case luaRe.MatchString(preamble):
+		inf.compilers = []string{"lualatex"}
+		inf.reasons = append(inf.reasons, fmt.Sprintf("%s needs LuaTeX", luaRe.FindString(preamble)))
+	case xetexRe.MatchString(preamble):
+		inf.compilers = []string{"xelatex"}
+		inf.reasons = append(inf.reasons, fmt.Sprintf("%s needs XeTeX", xetexRe.FindString(preamble)))
+	case fontspecRe.MatchString(preamble):
+		inf.compilers = []string{"xelatex", "lualatex"}
+		inf.reasons = append(inf.reasons, fmt.Sprintf("%s needs XeTeX or LuaTeX", fontspecRe.FindString(preamble)))
+	default:
+		inf.compilers = []string{defaultCompiler}
+	}
+	// biblatex uses biber by default
+	if m := biblatexRe.FindStringSubmatch(preamble); m != nil {
+		inf.biblio = "biber"
+		if b := backendRe.FindStringSubmatch(m[2]); b != nil {
+			inf.biblio = b[1]
+		}
+		inf.reasons = append(inf.reasons, fmt.Sprintf("biblatex uses %s", inf.biblio))
+	} else if bibtexRe.MatchString(content) {
+		inf.biblio = "bibtex"
+		inf.reasons = append(inf.reasons, `\bibliography uses bibtex`)
+	}
+	return inf
+}
+
+// setAutoCompiler replaces the auto compiler by the one inferred from the main file,
+// choosing the first suitable compiler supported by the candidate services.
+// The bibliography is set too, if not explicitly set.
+func setAutoCompiler(params *builder.Parameters, fname string, explicitBiblio bool) {
+	var content []byte
+	if fname != "" {
+		content, _ = os.ReadFile(fname)
+	}
+	if content == nil {
+		params.Log.Info("The compiler can't be inferred without a readable local main file, %s is used.", defaultCompiler)
+		params.Compiler = defaultCompiler
+		return
+	}
+	inf := inferCompiler(string(content))
+	if inf.biblio != "" && !explicitBiblio {
+		params.Biblio = inf.biblio
+	}
+	// the candidate services
+	var services []builder.Service
+	if params.Service != "" {
+		if s, ok := builder.Lookup(strings.ToLower(params.Service)); ok {
+			services = append(services, s)
+		}
+	} else {
+		services, _ = lookupServices(params.Services)
+	}
+	params.Compiler = chooseCompiler(services, inf.compilers, params.Biblio)
+	if params.Biblio != "" && !explicitBiblio && !supported(services, params.Compiler, params.Biblio) {
+		params.Log.Info("The %s bibliography is not supported by the services, it is not requested.", params.Biblio)
+		params.Biblio = ""
+		params.Compiler = chooseCompiler(services, inf.compilers, "")
+	}
+	reasons := "nothing special found"
+	if len(inf.reasons) > 0 {
+		reasons = strings.Join(inf.reasons, ", ")
+	}
+	if params.Biblio != "" {
+		params.Log.Info("The %s compiler with %s bibliography is used for %s (%s).", params.Compiler, params.Biblio, fname, reasons)
+	} else {
+		params.Log.Info("The %s compiler is used for %s (%s).", params.Compiler, fname, reasons)
+	}
+}
+
+// chooseCompiler returns the first compiler supported (with biblio) by one of the services,
+// or the first compiler if none is supported.
+func chooseCompiler(services []builder.Service, compilers []string, biblio string) string {
+	for _, c := range compilers {
+		if supported(services, c, biblio) {
+			return c
+		}
+	}
+	return compilers[0]
+}
+
+// supported checks if one of the services supports the compiler and the bibliography.
+func supported(services []builder.Service, compiler, biblio string) bool {
+	for _, s := range services {
+		if s.Supports(compiler, biblio) == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestInferCompiler(t *testing.T) {
+	tests := []struct {
+		content   string
+		compilers string
+		biblio    string
+	}{
+		{"\\documentclass{article}\n\\begin{document}\\end{document}", "[pdflatex]", ""},
+		{"\\documentclass{article}\n\\usepackage{amsmath,fontspec}\n", "[xelatex lualatex]", ""},
+		{"\\documentclass{article}\n\\usepackage[math-style=ISO]{unicode-math}\n\\usepackage{luacode}\n", "[lualatex]", ""},
+		{"\\documentclass{article}\n\\usepackage{xeCJK}\n", "[xelatex]", ""},
+		{"\\documentclass{article}\n% \\usepackage{fontspec}\n", "[pdflatex]", ""},
+		{"\\documentclass{article}\n\\begin{document}\n\\verb|\\usepackage{fontspec}|\n\\end{document}", "[pdflatex]", ""},
+		{"\\setupbodyfont[11pt]\n\\starttext\nHello\n\\stoptext\n", "[context]", ""},
+		{"\\documentclass{article}\n\\usepackage{biblatex}\n", "[pdflatex]", "biber"},
+		{"\\documentclass{article}\n\\usepackage[style=alpha,backend=bibtex]{biblatex}\n", "[pdflatex]", "bibtex"},
+		{"\\documentclass{article}\n\\begin{document}\n\\bibliography{refs}\n\\end{document}", "[pdflatex]", "bibtex"},
+	}
+	for _, test := range tests {
+		inf := inferCompiler(test.content)
+		if fmt.Sprint(inf.compilers) != test.compilers || inf.biblio != test.biblio {
+			t.Errorf("Wrong inference for:\n%s\ngot %v %q, expected %s %q", test.content, inf.compilers, inf.biblio, test.compilers, test.biblio)
+		}
+		if (test.compilers != "[pdflatex]" || test.biblio != "") && len(inf.reasons) == 0 {
+			t.Errorf("No reason given for:\n%s", test.content)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/kpym/lol/builder"
+	"github.com/spf13/viper"
+)
+
+// magicLines is the number of lines where the magic comments are looked for (as in TeXShop).
+const magicLines = 20
+
+// magicRe matches the magic comments like % !TEX program = xelatex or % !BIB TS-program = biber.
+var magicRe = regexp.MustCompile(`(?i)^\s*%+\s*!\s*(tex|bib)\s+(?:ts-)?(program|root)\s*=\s*(.*?)\s*$`)
+
+// magic contains the values of the magic comments of a file.
+type magic struct {
+	program string
+	root    string
+	bib     string
+}
+
+// readMagic reads the magic comments at the beginning of the file.
+func readMagic(fname string) (magic, error) {
+	var m magic
+	f, err := os.Open(fname)
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 0; n < magicLines && scanner.Scan(); n++ {
+		match := magicRe.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		switch strings.ToLower(match[1] + " " + match[2]) {
+		case "tex program":
+			// the TeXShop engines like xelatexmk use latexmk
+			m.program = strings.TrimSuffix(strings.ToLower(match[3]), "mk")
+		case "tex root":
+			m.root = match[3]
+		case "bib program":
+			m.bib = strings.ToLower(match[3])
+		}
+	}
+	return m, scanner.Err()
+}
+
+// setMagic uses the magic comments of the main file (or of the first file if there is no main)
+// to set params.Main (following % !TEX root), params.Compiler and params.Biblio,
+// unless they are set explicitly (by flag, config file or environment variable).
+// It returns true if params.Main is set to a magic root.
+func setMagic(v *viper.Viper, params *builder.Parameters, args []string) (bool, error) {
+	fname := mainFile(*params, args)
+	if fname == "" {
+		return false, nil
+	}
+	m, err := readMagic(fname)
+	if err != nil {
+		// the missing files are reported later
+		return false, nil
+	}
+	// follow the roots (the comments of the root take precedence)
+	explicit := v.IsSet("main") || v.IsSet("target")
+	if explicit && m.root != "" {
+		params.Log.Info("The magic root of %s is ignored, the main file is set.", fname)
+	}
+	start := fname
+	seen := map[string]bool{filepath.Clean(fname): true}
+	for m.root != "" && !explicit {
+		root := filepath.Join(filepath.Dir(fname), filepath.FromSlash(m.root))
+		if seen[root] {
+			break
+		}
+		seen[root] = true
+		rm, err := readMagic(root)
+		if err != nil {
+			return false, fmt.Errorf("Can't read the root file %s (from the magic comment of %s): %w", root, fname, err)
+		}
+		params.Log.Info("The root of %s is %s (from the magic comment).", fname, root)
+		fname = root
+		if rm.program == "" {
+			rm.program = m.program
+		}
+		if rm.bib == "" {
+			rm.bib = m.bib
+		}
+		m = rm
+	}
+	rooted := fname != start
+	if rooted {
+		params.Main = fname
+	}
+	// the compiler and the bibliography are checked with the service selection
+	if m.program != "" && (!v.IsSet("compiler") || params.Compiler == autoCompiler) {
+		params.Log.Info("The %s compiler is used (from the magic comment of %s).", m.program, fname)
+		params.Compiler = m.program
+	}
+	if m.bib != "" && !v.IsSet("biblio") {
+		params.Log.Info("The %s bibliography is used (from the magic comment of %s).", m.bib, fname)
+		params.Biblio = m.bib
+	}
+	return rooted, nil
+}
+
+// setRoot sets params.Root to the folder of the main file (a magic root),
+// so the files are read from this folder and sent with names relative to it (like chapters/three.tex).
+// The Main and the Patterns are rebased on this folder.
+func setRoot(params *builder.Parameters) error {
+	root := filepath.Dir(params.Main)
+	if root == "." {
+		return nil
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	rebase := func(name string) (string, error) {
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Rel(absRoot, abs)
+	}
+	names := []*string{&params.Main}
+	for i := range params.Patterns {
+		names = append(names, &params.Patterns[i])
+	}
+	for _, name := range names {
+		*name, err = rebase(*name)
+		if err != nil {
+			return err
+		}
+	}
+	params.Root = root
+	params.Log.Info("The files are sent from %s, the folder of the root file %s.", root, params.Main)
+	return nil
+}
+
+// rootPath returns the local name of a file named relative to params.Root.
+func rootPath(params builder.Parameters, name string) string {
+	if params.Root == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(params.Root, name)
+}
+
+// rootName returns the name relative to params.Root of a local file.
+func rootName(params builder.Parameters, fname string) string {
+	if params.Root == "" || filepath.IsAbs(fname) {
+		return fname
+	}
+	name, err := filepath.Rel(params.Root, fname)
+	if err != nil {
+		return fname
+	}
+	return name
+}
+
+// mainFile returns the local main file: params.Main,
+// or the first file if there is no main (and no piped input).
+// It returns an empty string if there is no local main file.
+func mainFile(params builder.Parameters, args []string) string {
+	if GetSource(params) != nil {
+		return ""
+	}
+	if params.Main == "" && len(args) > 0 && !stdinPiped() {
+		return args[0]
+	}
+	return params.Main
+}
+
+// stdinPiped checks if the main file is piped to stdin.
+func stdinPiped() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && (fi.Mode()&os.ModeCharDevice) == 0 && (fi.Mode()&os.ModeNamedPipe != 0)
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/log"
+	"github.com/spf13/viper"
+)
+
+func TestSetMagic(t *testing.T) {
+	writeTree(t, map[string]string{
+		"thesis.tex":         "% !TEX TS-program = XeLaTeX\n%!BIB program=biber\n\\documentclass{book}\n",
+		"chapters/three.tex": "% !TeX root = ../thesis.tex\n% !TEX program = lualatexmk\n\\chapter{Three}\n",
+	})
+	thesis := "thesis.tex"
+	chapter := filepath.Join("chapters", "three.tex")
+
+	tests := []struct {
+		name     string
+		main     string
+		args     []string
+		set      map[string]string
+		expected builder.Parameters
+	}{
+		{"root", "", []string{chapter}, nil, builder.Parameters{Main: thesis, Compiler: "xelatex", Biblio: "biber"}},
+		{"main", thesis, nil, nil, builder.Parameters{Main: thesis, Compiler: "xelatex", Biblio: "biber"}},
+		{"explicit compiler", "", []string{chapter}, map[string]string{"compiler": "pdflatex"}, builder.Parameters{Main: thesis, Compiler: "pdflatex", Biblio: "biber"}},
+		{"explicit main", chapter, nil, map[string]string{"main": chapter}, builder.Parameters{Main: chapter, Compiler: "lualatex"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := viper.New()
+			params := builder.Parameters{Log: log.New(log.WithLevel(log.Quiet)), Main: test.main, Compiler: "pdflatex"}
+			for k, val := range test.set {
+				v.Set(k, val)
+				if k == "compiler" {
+					params.Compiler = val
+				}
+			}
+			if _, err := setMagic(v, &params, test.args); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if params.Main != test.expected.Main || params.Compiler != test.expected.Compiler || params.Biblio != test.expected.Biblio {
+				t.Errorf("Wrong parameters: main %q, compiler %q, biblio %q, expected %q, %q, %q",
+					params.Main, params.Compiler, params.Biblio, test.expected.Main, test.expected.Compiler, test.expected.Biblio)
+			}
+		})
+	}
+}
+
+func TestMagicRoot(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		".lolignore":         "draft.tex\n",
+		"thesis.tex":         "\\documentclass{book}\n\\begin{document}\n\\input{chapters/three}\n\\end{document}\n",
+		"chapters/three.tex": "% !TEX root = ../thesis.tex\n\\chapter{Three}\n",
+		"chapters/draft.tex": "Draft.\n",
+	})
+	chapters := filepath.Join(dir, "chapters")
+	if err := os.Chdir(chapters); err != nil {
+		t.Fatal(err)
+	}
+	// lol --service laton three.tex . (from the chapters folder)
+	parseArgs(t, "--quiet", "--service", "laton", "three.tex", ".")
+
+	var params builder.Parameters
+	if err := GetParameters(context.Background(), &params); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if params.Root != ".." || params.Main != "thesis.tex" {
+		t.Errorf("Wrong root %q and main %q, expected .. and thesis.tex.", params.Root, params.Main)
+	}
+	if params.Output != filepath.Join("..", "thesis.pdf") {
+		t.Errorf("Wrong output %q, expected ../thesis.pdf.", params.Output)
+	}
+	if wd, _ := os.Getwd(); !sameFile(wd, chapters) {
+		t.Errorf("The current folder has changed to %s.", wd)
+	}
+	// the files are named relative to the root, and the .lolignore of the root is used
+	files, err := GetFiles(params)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "chapters/three.tex thesis.tex" {
+		t.Errorf("Wrong files: %v, expected [chapters/three.tex thesis.tex].", names)
+	}
+}
+
+// sameFile checks if the two names are the same file (the temporary folder can be a symbolic link).
+func sameFile(a, b string) bool {
+	fa, errA := os.Stat(a)
+	fb, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(fa, fb)
+}
@@ -0,0 +1,71 @@
+package builder
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Auth contains the credentials for the services (and remote files) with base url Url.
+// The Token is sent as bearer token, the User and the Password with basic authentication,
+// and the Headers are added as they are.
+type Auth struct {
+	Url      string
+	Token    string
+	User     string
+	Password string
+	Headers  map[string]string
+}
+
+// matches checks if the request url is under the Auth url.
+func (a Auth) matches(url string) bool {
+	base := strings.TrimSuffix(a.Url, "/")
+	return base != "" && (url == base || strings.HasPrefix(url, base+"/") || strings.HasPrefix(url, base+"?"))
+}
+
+// apply adds the credentials to the request.
+func (a Auth) apply(req *http.Request) {
+	for k, v := range a.Headers {
+		req.Header.Set(k, v)
+	}
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	} else if a.User != "" {
+		req.SetBasicAuth(a.User, a.Password)
+	}
+}
+
+// String provides the Stringer interface for Auth.
+// The secrets are never shown.
+func (a Auth) String() string {
+	var kinds []string
+	if a.Token != "" {
+		kinds = append(kinds, "bearer token")
+	} else if a.User != "" {
+		kinds = append(kinds, "basic auth as "+a.User)
+	}
+	if len(a.Headers) > 0 {
+		kinds = append(kinds, fmt.Sprintf("%d headers", len(a.Headers)))
+	}
+	return fmt.Sprintf("%s (%s)", a.Url, strings.Join(kinds, ", "))
+}
+
+// authTransport adds the credentials of the first matching Auth to the requests.
+type authTransport struct {
+	base  http.RoundTripper
+	auths []Auth
+}
+
+// RoundTrip provides the http.RoundTripper interface for authTransport.
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	for _, a := range t.auths {
+		if a.matches(url) {
+			// the request should not be modified by a RoundTripper
+			req = req.Clone(req.Context())
+			a.apply(req)
+			break
+		}
+	}
+	return t.base.RoundTrip(req)
+}
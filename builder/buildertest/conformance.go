@@ -0,0 +1,243 @@
+package buildertest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/log"
+)
+
+// Request returns a typical request for the service at url.
+func Request(service builder.Service, url string) builder.Request {
+	return builder.Request{
+		Parameters: builder.Parameters{
+			Log:      log.New(log.WithLevel(log.Quiet)),
+			Service:  service.Name,
+			Url:      url,
+			Compiler: service.Compilers[0],
+			Main:     "main.tex",
+		},
+		Files: builder.Files{
+			"main.tex":             []byte("\\documentclass{article}\n\\begin{document}\n\\input{chapters/one}\n\\end{document}\n"),
+			"chapters/one.tex":     []byte("Hello \"world\" \\o/\n"),
+			"images/logo.png":      {0x89, 'P', 'N', 'G', 0, 1, 2, 3, 0xff},
+			"name with 'quote'":    []byte("strange name"),
+			"name \"with\" \\.tex": []byte("strange name"),
+		},
+	}
+}
+
+// Run runs the conformance suite on the service Builder, that should talk to srv.
+// The suite checks that:
+// - the parameters and the files are received by the server,
+// - the remote files are sent or referenced,
+// - a git or an url source is sent, or rejected with a *builder.CapabilityError,
+// - the pdf is returned on success,
+// - a compilation error is a *builder.CompileError with the log,
+// - a server error (5xx) and an unreachable server are temporary errors,
+// - an answer that is not a pdf is a *builder.ProtocolError with a snippet,
+// - the build is aborted when the context is canceled.
+func Run(t *testing.T, service builder.Service, srv *Server) {
+	t.Run("Success", func(t *testing.T) {
+		srv.SetResponse(Response{})
+		req := Request(service, srv.URL)
+		res, err := service.New().BuildPDF(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !bytes.Equal(res.PDF, SamplePDF) {
+			t.Errorf("Wrong pdf: %q", res.PDF)
+		}
+		if res.Service != service.Name {
+			t.Errorf("Wrong service in the result: %q", res.Service)
+		}
+		rec := srv.Last()
+		if rec.Compiler != req.Parameters.Compiler {
+			t.Errorf("Wrong compiler received: %q", rec.Compiler)
+		}
+		if rec.Main != "" && rec.Main != req.Parameters.Main {
+			t.Errorf("Wrong main file received: %q", rec.Main)
+		}
+		if !bytes.Equal(rec.Files[rec.Main], req.Files[req.Parameters.Main]) {
+			t.Errorf("Wrong main file content received: %q", rec.Files[rec.Main])
+		}
+		for name, data := range req.Files {
+			if name == req.Parameters.Main {
+				continue
+			}
+			if !bytes.Equal(rec.Files[name], data) {
+				t.Errorf("Wrong content received for %s: %q", name, rec.Files[name])
+			}
+		}
+	})
+
+	if len(service.Biblios) > 0 {
+		t.Run("Biblio", func(t *testing.T) {
+			srv.SetResponse(Response{})
+			req := Request(service, srv.URL)
+			req.Parameters.Biblio = service.Biblios[0]
+			_, err := service.New().BuildPDF(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if b := srv.Last().Biblio; b != req.Parameters.Biblio {
+				t.Errorf("Wrong biblio received: %q", b)
+			}
+		})
+	}
+
+	t.Run("Remote", func(t *testing.T) {
+		content := []byte("\\ProvidesClass{corporate}\n")
+		remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(content)
+		}))
+		defer remote.Close()
+		srv.SetResponse(Response{})
+		req := Request(service, srv.URL)
+		req.Parameters.Remote = []builder.RemoteFile{{Path: "corporate.cls", Url: remote.URL + "/corporate.cls"}}
+		_, err := service.New().BuildPDF(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		rec := srv.Last()
+		if !bytes.Equal(rec.Files["corporate.cls"], content) && rec.Remote["corporate.cls"] != remote.URL+"/corporate.cls" {
+			t.Errorf("The remote file was neither sent nor referenced: %q, %v", rec.Files["corporate.cls"], rec.Remote)
+		}
+	})
+
+	t.Run("Git", func(t *testing.T) {
+		srv.SetResponse(Response{})
+		req := Request(service, srv.URL)
+		req.Files = nil
+		req.Source = &builder.GitSource{Repo: "https://example.com/paper.git", Branch: "draft"}
+		res, err := service.New().BuildPDF(context.Background(), req)
+		if service.Accepts(req) != nil {
+			var caperr *builder.CapabilityError
+			if !errors.As(err, &caperr) {
+				t.Fatalf("Expected a CapabilityError, got %T: %v", err, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !bytes.Equal(res.PDF, SamplePDF) {
+			t.Errorf("Wrong pdf: %q", res.PDF)
+		}
+		rec := srv.Last()
+		if rec.Git != "https://example.com/paper.git" || rec.Branch != "draft" {
+			t.Errorf("Wrong git repository received: %q (branch %q)", rec.Git, rec.Branch)
+		}
+		if rec.Main != req.Parameters.Main {
+			t.Errorf("Wrong main file received: %q", rec.Main)
+		}
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		srv.SetResponse(Response{})
+		req := Request(service, srv.URL)
+		req.Files = nil
+		req.Source = &builder.URLSource{Url: "https://example.com/paper.tex"}
+		res, err := service.New().BuildPDF(context.Background(), req)
+		if service.Accepts(req) != nil {
+			var caperr *builder.CapabilityError
+			if !errors.As(err, &caperr) {
+				t.Fatalf("Expected a CapabilityError, got %T: %v", err, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !bytes.Equal(res.PDF, SamplePDF) {
+			t.Errorf("Wrong pdf: %q", res.PDF)
+		}
+		rec := srv.Last()
+		if rec.Remote[rec.Main] != "https://example.com/paper.tex" {
+			t.Errorf("The main file url was not received: %v", rec.Remote)
+		}
+	})
+
+	t.Run("CompileError", func(t *testing.T) {
+		log := "! Undefined control sequence.\nl.3 \\foo\n"
+		srv.SetResponse(Response{Log: log})
+		_, err := service.New().BuildPDF(context.Background(), Request(service, srv.URL))
+		var comperr *builder.CompileError
+		if !errors.As(err, &comperr) {
+			t.Fatalf("Expected a CompileError, got %T: %v", err, err)
+		}
+		if !strings.Contains(comperr.Log, "Undefined control sequence") {
+			t.Errorf("The log is missing in the error: %q", comperr.Log)
+		}
+		if comperr.Service != service.Name {
+			t.Errorf("Wrong service in the error: %q", comperr.Service)
+		}
+		if builder.Temporary(err) {
+			t.Errorf("A compilation error should not be temporary.")
+		}
+	})
+
+	t.Run("ServerError", func(t *testing.T) {
+		srv.SetResponse(Response{Status: 503, Body: []byte("Service Unavailable")})
+		_, err := service.New().BuildPDF(context.Background(), Request(service, srv.URL))
+		var comperr *builder.CompileError
+		if err == nil || errors.As(err, &comperr) {
+			t.Fatalf("Expected a server error, got %T: %v", err, err)
+		}
+		if !builder.Temporary(err) {
+			t.Errorf("A server error should be temporary: %v", err)
+		}
+	})
+
+	t.Run("NotPDF", func(t *testing.T) {
+		html := "<html><body>Please login</body></html>"
+		srv.SetResponse(Response{Status: 200, Body: []byte(html), ContentType: "text/html"})
+		_, err := service.New().BuildPDF(context.Background(), Request(service, srv.URL))
+		var perr *builder.ProtocolError
+		if !errors.As(err, &perr) {
+			t.Fatalf("Expected a ProtocolError, got %T: %v", err, err)
+		}
+		if !strings.Contains(perr.Snippet, "Please login") {
+			t.Errorf("The answer is missing in the error: %q", perr.Snippet)
+		}
+		srv.SetResponse(Response{PDF: SamplePDF[:len(SamplePDF)-8]})
+		_, err = service.New().BuildPDF(context.Background(), Request(service, srv.URL))
+		if !errors.As(err, &perr) {
+			t.Fatalf("Expected a ProtocolError for a truncated pdf, got %T: %v", err, err)
+		}
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		closed := NewLaton()
+		closed.Close()
+		_, err := service.New().BuildPDF(context.Background(), Request(service, closed.URL))
+		var terr *builder.TransportError
+		if !errors.As(err, &terr) {
+			t.Fatalf("Expected a TransportError, got %T: %v", err, err)
+		}
+		if !builder.Temporary(err) {
+			t.Errorf("A transport error should be temporary.")
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		srv.SetResponse(Response{Delay: time.Minute})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := service.New().BuildPDF(ctx, Request(service, srv.URL))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the context error, got %T: %v", err, err)
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Errorf("The build was not aborted.")
+		}
+	})
+}
@@ -0,0 +1,189 @@
+// buildertest package provides tools to test builder.Builder implementations without network:
+// - in-process fake servers that implement the laton and the ytotech wire protocols,
+// - a conformance suite that any Builder can be run through.
+package buildertest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/kpym/lol/builder"
+)
+
+// SamplePDF is the pdf returned by the fake servers by default.
+var SamplePDF = []byte("%PDF-1.5\n1 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n")
+
+// Received is a build request as decoded by a fake server.
+type Received struct {
+	Compiler string
+	Biblio   string
+	Force    bool
+	// Main is the name of the main file ("" if the service received it without name).
+	Main  string
+	Files builder.Files
+	// Cached lists the files sent by hash and found in the server cache.
+	Cached []string
+	// Remote maps the filenames to the urls of the files to be fetched by the service.
+	Remote map[string]string
+	// Git and Branch are set when the service was asked to clone a git repository.
+	Git    string
+	Branch string
+	// Raw is the raw request body (to check protocol specific details).
+	Raw []byte
+}
+
+// Response is the canned answer of a fake server.
+type Response struct {
+	// Status is the http status code. If 0, 200 is used if Log is empty, 400 otherwise.
+	Status int
+	// PDF is returned on success (SamplePDF if nil).
+	PDF []byte
+	// Log is the compilation log returned on error.
+	Log string
+	// Body, if not nil, is returned as is (ignoring PDF and Log).
+	Body []byte
+	// ContentType of the answer (guessed if empty).
+	ContentType string
+	// Delay before answering.
+	Delay time.Duration
+}
+
+// status returns the status code to use.
+func (r Response) status() int {
+	switch {
+	case r.Status != 0:
+		return r.Status
+	case r.Log != "":
+		return http.StatusBadRequest
+	}
+	return http.StatusOK
+}
+
+// pdf returns the pdf to answer.
+func (r Response) pdf() []byte {
+	if r.PDF == nil {
+		return SamplePDF
+	}
+	return r.PDF
+}
+
+// Server is a fake compilation service.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	received []Received
+	respond  func(Received) Response
+	// the resources cache (by hash)
+	resources map[string][]byte
+}
+
+// newServer starts a fake server with a protocol specific handler.
+func newServer(handler func(s *Server) http.Handler) *Server {
+	s := &Server{
+		respond:   func(Received) Response { return Response{} },
+		resources: make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(handler(s))
+	return s
+}
+
+// SetResponse sets the answer to all following requests.
+func (s *Server) SetResponse(r Response) {
+	s.Respond(func(Received) Response { return r })
+}
+
+// Respond sets the function that computes the answer of the following requests.
+func (s *Server) Respond(f func(Received) Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.respond = f
+}
+
+// Received returns all requests received so far.
+func (s *Server) Received() []Received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Received(nil), s.received...)
+}
+
+// Last returns the last request received (or an empty one).
+func (s *Server) Last() Received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.received) == 0 {
+		return Received{}
+	}
+	return s.received[len(s.received)-1]
+}
+
+// ForgetResources empties the server resources cache.
+func (s *Server) ForgetResources() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resources = make(map[string][]byte)
+}
+
+// cacheResource saves data in the resources cache.
+func (s *Server) cacheResource(hash string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resources[hash] = data
+}
+
+// cachedResource returns the data with this hash from the resources cache.
+func (s *Server) cachedResource(hash string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.resources[hash]
+	return data, ok
+}
+
+// store saves the request and returns the answer to send.
+func (s *Server) store(rec Received) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, rec)
+	return s.respond(rec)
+}
+
+// record saves the request and returns the answer to send.
+// It waits for the response delay (or until ctx is done).
+func (s *Server) record(ctx context.Context, rec Received) (Response, bool) {
+	resp := s.store(rec)
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-ctx.Done():
+			return resp, false
+		}
+	}
+	return resp, true
+}
+
+// writeBody writes the raw body of resp if set, and returns true in this case.
+func writeBody(w http.ResponseWriter, resp Response) bool {
+	if resp.Body == nil {
+		return false
+	}
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	w.WriteHeader(resp.status())
+	w.Write(resp.Body)
+	return true
+}
+
+// writePDF writes the pdf of a successful answer.
+func writePDF(w http.ResponseWriter, resp Response) {
+	ct := resp.ContentType
+	if ct == "" {
+		ct = "application/pdf"
+	}
+	w.Header().Set("Content-Type", ct)
+	w.WriteHeader(resp.status())
+	w.Write(resp.pdf())
+}
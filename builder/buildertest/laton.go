@@ -0,0 +1,110 @@
+package buildertest
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"net/http"
+
+	"github.com/kpym/lol/builder"
+)
+
+// NewLaton starts a fake latexonline.cc server.
+// It accepts a POST on /data with a multipart "file" containing the sources as .tar.gz,
+// and the target, command and force url parameters.
+// It also accepts a GET on /compile with the git (and branch) url parameters,
+// to compile a git repository, with the url parameter, to compile a remote file,
+// or with the text parameter, to compile a single file sent without name.
+// The server should be closed after use.
+func NewLaton() *Server {
+	return newServer(func(s *Server) http.Handler {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/compile", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			query := r.URL.Query()
+			rec := Received{
+				Main:     query.Get("target"),
+				Compiler: query.Get("command"),
+				Force:    query.Get("force") == "true",
+				Git:      query.Get("git"),
+				Branch:   query.Get("branch"),
+			}
+			switch {
+			case query.Has("text"):
+				rec.Files = builder.Files{"": []byte(query.Get("text"))}
+			case query.Has("url"):
+				rec.Remote = map[string]string{rec.Main: query.Get("url")}
+			case rec.Git == "":
+				http.Error(w, "missing git, url or text parameter", http.StatusBadRequest)
+				return
+			}
+			latonAnswer(s, w, r, rec)
+		})
+		mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			rec := Received{
+				Main:     r.URL.Query().Get("target"),
+				Compiler: r.URL.Query().Get("command"),
+				Force:    r.URL.Query().Get("force") == "true",
+			}
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "missing file: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			rec.Files, err = untar(file)
+			if err != nil {
+				http.Error(w, "bad tar.gz: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			latonAnswer(s, w, r, rec)
+		})
+		return mux
+	})
+}
+
+// latonAnswer records the request and writes the answer as latexonline.cc does:
+// the pdf on success and the log as text otherwise.
+func latonAnswer(s *Server, w http.ResponseWriter, r *http.Request, rec Received) {
+	resp, ok := s.record(r.Context(), rec)
+	if !ok || writeBody(w, resp) {
+		return
+	}
+	if resp.status() < 200 || resp.status() > 299 {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(resp.status())
+		io.WriteString(w, resp.Log)
+		return
+	}
+	writePDF(w, resp)
+}
+
+// untar reads all files from a .tar.gz.
+func untar(r io.Reader) (builder.Files, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	files := make(builder.Files)
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[hdr.Name], err = io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
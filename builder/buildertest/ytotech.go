@@ -0,0 +1,204 @@
+package buildertest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpym/lol/builder"
+)
+
+// ytotechRequest is the json sent to latex-on-http.
+type ytotechRequest struct {
+	Compiler string `json:"compiler"`
+	Options  struct {
+		Bibliography struct {
+			Command string `json:"command"`
+		} `json:"bibliography"`
+	} `json:"options"`
+	Resources []struct {
+		Main    bool   `json:"main"`
+		Path    string `json:"path"`
+		File    string `json:"file"`
+		Content string `json:"content"`
+		Url     string `json:"url"`
+		Hash    string `json:"hash"`
+	} `json:"resources"`
+}
+
+// ytotechResource identifies a resource missing in the cache.
+type ytotechResource struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// NewYtotech starts a fake latex.ytotech.com (latex-on-http) server.
+// It accepts a POST on /builds/sync with the json resources.
+// The url resources are not fetched, they are recorded in Received.Remote.
+// The resources sent with hash are kept in cache, and can be sent by hash only next time.
+// If such a resource is not in the cache, the server answers with 406 and the list of missing resources.
+// The errors are answered with a json containing error and logs.
+// The asynchronous builds are submitted with a POST on /builds,
+// their status is at /builds/{id} and their pdf at /builds/{id}/output.pdf.
+// For these builds the Response.Delay is the time before the build is done.
+// The server should be closed after use.
+func NewYtotech() *Server {
+	return newServer(func(s *Server) http.Handler {
+		var (
+			mu     sync.Mutex
+			builds = make(map[string]*ytotechBuild)
+		)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/builds/sync", func(w http.ResponseWriter, r *http.Request) {
+			rec, ok := ytotechDecode(s, w, r)
+			if !ok {
+				return
+			}
+			resp, ok := s.record(r.Context(), rec)
+			if !ok || writeBody(w, resp) {
+				return
+			}
+			if resp.status() < 200 || resp.status() > 299 {
+				ytotechError(w, resp.status(), "COMPILATION_ERROR", resp.Log)
+				return
+			}
+			writePDF(w, resp)
+		})
+		mux.HandleFunc("/builds", func(w http.ResponseWriter, r *http.Request) {
+			rec, ok := ytotechDecode(s, w, r)
+			if !ok {
+				return
+			}
+			resp := s.store(rec)
+			if writeBody(w, resp) {
+				return
+			}
+			mu.Lock()
+			id := fmt.Sprintf("build-%d", len(builds)+1)
+			builds[id] = &ytotechBuild{resp: resp, done: time.Now().Add(resp.Delay)}
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]string{"id": id, "status": "pending"})
+		})
+		mux.HandleFunc("/builds/", func(w http.ResponseWriter, r *http.Request) {
+			id, output := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/builds/"), "/output.pdf")
+			mu.Lock()
+			b, ok := builds[id]
+			mu.Unlock()
+			if !ok {
+				ytotechError(w, http.StatusNotFound, "UNKNOWN_BUILD", "")
+				return
+			}
+			status := b.status()
+			if output {
+				if status != "success" {
+					ytotechError(w, http.StatusNotFound, "NO_OUTPUT", "")
+					return
+				}
+				writePDF(w, b.resp)
+				return
+			}
+			answer := map[string]string{"id": id, "status": status}
+			if status == "failure" {
+				answer["error"] = "COMPILATION_ERROR"
+				answer["logs"] = b.resp.Log
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(answer)
+		})
+		return mux
+	})
+}
+
+// ytotechBuild is an asynchronous build.
+type ytotechBuild struct {
+	resp Response
+	done time.Time
+}
+
+// status returns the current status of the build.
+func (b *ytotechBuild) status() string {
+	switch {
+	case time.Now().Before(b.done):
+		return "running"
+	case b.resp.status() < 200 || b.resp.status() > 299:
+		return "failure"
+	}
+	return "success"
+}
+
+// ytotechDecode reads the json request.
+// In case of problem the error is answered and false is returned.
+func ytotechDecode(s *Server, w http.ResponseWriter, r *http.Request) (Received, bool) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return Received{}, false
+	}
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		return Received{}, false
+	}
+	var yreq ytotechRequest
+	err = json.Unmarshal(raw, &yreq)
+	if err != nil {
+		ytotechError(w, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return Received{}, false
+	}
+	rec := Received{
+		Compiler: yreq.Compiler,
+		Biblio:   yreq.Options.Bibliography.Command,
+		Files:    make(builder.Files),
+		Remote:   make(map[string]string),
+		Raw:      raw,
+	}
+	var missing []ytotechResource
+	for _, res := range yreq.Resources {
+		if res.Main {
+			rec.Main = res.Path
+		}
+		if res.Url != "" {
+			rec.Remote[res.Path] = res.Url
+			continue
+		}
+		data := []byte(res.Content)
+		if res.File != "" {
+			data, err = base64.StdEncoding.DecodeString(res.File)
+			if err != nil {
+				ytotechError(w, http.StatusBadRequest, "INVALID_RESOURCE", err.Error())
+				return Received{}, false
+			}
+		}
+		if res.Hash != "" && res.File == "" && res.Content == "" {
+			var ok bool
+			data, ok = s.cachedResource(res.Hash)
+			if !ok {
+				missing = append(missing, ytotechResource{Path: res.Path, Hash: res.Hash})
+				continue
+			}
+			rec.Cached = append(rec.Cached, res.Path)
+		} else if res.Hash != "" {
+			s.cacheResource(res.Hash, data)
+		}
+		rec.Files[res.Path] = data
+	}
+	if len(missing) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotAcceptable)
+		json.NewEncoder(w).Encode(map[string]any{"error": "MISSING_RESOURCES", "resources": missing})
+		return Received{}, false
+	}
+	return rec, true
+}
+
+// ytotechError answers with a json error.
+func ytotechError(w http.ResponseWriter, status int, code, logs string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "logs": logs})
+}
@@ -0,0 +1,164 @@
+package builder
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The services listening on a unix socket have base url like unix:///path/to/socket.
+// The requests are then sent to http://unix/... and the connection is made to the socket.
+const (
+	unixScheme = "unix://"
+	unixHost   = "unix"
+)
+
+// default transport timeouts (as in http.DefaultTransport)
+const (
+	defaultConnectTimeout = 30 * time.Second
+	defaultTLSTimeout     = 10 * time.Second
+)
+
+// clientConfig contains the Parameters used to configure the http client.
+type clientConfig struct {
+	socket         string
+	proxy          string
+	caFile         string
+	cert           string
+	key            string
+	insecure       bool
+	connectTimeout time.Duration
+}
+
+// transports keeps the http transports by configuration, so the connections are reused.
+var transports sync.Map
+
+// NewClient returns the http client configured by the parameters:
+// proxy, extra CA file, client certificate, insecure mode, connection timeout,
+// unix socket (if Url starts with unix://) and credentials (Auth).
+// The requests should be sent to BaseURL(params).
+func NewClient(params Parameters) (*http.Client, error) {
+	cfg := clientConfig{
+		proxy:          params.Proxy,
+		caFile:         params.CAFile,
+		cert:           params.Cert,
+		key:            params.Key,
+		insecure:       params.Insecure,
+		connectTimeout: params.ConnectTimeout,
+	}
+	if strings.HasPrefix(params.Url, unixScheme) {
+		cfg.socket = strings.TrimPrefix(params.Url, unixScheme)
+	}
+	var transport http.RoundTripper
+	if t, ok := transports.Load(cfg); ok {
+		transport = t.(http.RoundTripper)
+	} else {
+		t, err := cfg.transport()
+		if err != nil {
+			return nil, err
+		}
+		stored, _ := transports.LoadOrStore(cfg, t)
+		transport = stored.(http.RoundTripper)
+	}
+	if auths := clientAuths(params); len(auths) > 0 {
+		transport = &authTransport{base: transport, auths: auths}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// clientAuths returns the Auth of the parameters with urls usable by the client
+// (the unix socket url is replaced by its BaseURL).
+func clientAuths(params Parameters) []Auth {
+	auths := make([]Auth, 0, len(params.Auth))
+	for _, a := range params.Auth {
+		if strings.HasPrefix(a.Url, unixScheme) {
+			if a.Url != params.Url {
+				continue
+			}
+			a.Url = BaseURL(params)
+		}
+		auths = append(auths, a)
+	}
+	return auths
+}
+
+// BaseURL returns the base url of the service to use with the client from NewClient.
+func BaseURL(params Parameters) string {
+	if strings.HasPrefix(params.Url, unixScheme) {
+		return "http://" + unixHost
+	}
+	return params.Url
+}
+
+// transport creates a new http transport with this configuration.
+func (cfg clientConfig) transport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	// the proxy (the environment variables are used by default)
+	if cfg.proxy != "" {
+		proxy, err := url.Parse(cfg.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Bad proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	proxyFunc := transport.Proxy
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if cfg.socket != "" && req.URL.Host == unixHost {
+			return nil, nil
+		}
+		return proxyFunc(req)
+	}
+
+	// the connection (to the unix socket if needed)
+	dialer := &net.Dialer{Timeout: defaultConnectTimeout, KeepAlive: 30 * time.Second}
+	transport.TLSHandshakeTimeout = defaultTLSTimeout
+	if cfg.connectTimeout > 0 {
+		dialer.Timeout = cfg.connectTimeout
+		transport.TLSHandshakeTimeout = cfg.connectTimeout
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if cfg.socket != "" && addr == unixHost+":80" {
+			return dialer.DialContext(ctx, "unix", cfg.socket)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	// the certificates
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.insecure}
+	if cfg.caFile != "" {
+		pem, err := os.ReadFile(cfg.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Can't read the CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found in the CA file %s.", cfg.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.cert != "" || cfg.key != "" {
+		if cfg.cert == "" || cfg.key == "" {
+			return nil, fmt.Errorf("The client certificate needs both cert and key files.")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.cert, cfg.key)
+		if err != nil {
+			return nil, fmt.Errorf("Can't load the client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
@@ -0,0 +1,95 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CompileError is returned when the service compiled the sources but the compilation failed.
+// It means that the document is broken, so retrying (or using another service) is useless.
+type CompileError struct {
+	Service    string
+	StatusCode int
+	Log        string
+}
+
+// Error provides the error interface for CompileError.
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("%s compilation error (status code %d).", e.Service, e.StatusCode)
+}
+
+// TransportError is returned when the service can't be reached
+// or the connection is lost before the full answer is received.
+type TransportError struct {
+	Service string
+	Err     error
+}
+
+// Error provides the error interface for TransportError.
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%s connection problem: %v", e.Service, e.Err)
+}
+
+// Unwrap returns the underlying network error.
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// ProtocolError is returned when the service answer is not the expected one,
+// like a 5xx status code or a malformed answer.
+// Snippet is the beginning of the answer, when it helps to understand what was received
+// (like the html page of a proxy instead of a pdf).
+type ProtocolError struct {
+	Service    string
+	StatusCode int
+	Reason     string
+	Snippet    string
+}
+
+// Error provides the error interface for ProtocolError.
+func (e *ProtocolError) Error() string {
+	msg := fmt.Sprintf("%s unexpected answer: %s", e.Service, e.Reason)
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("%s unexpected answer (status code %d): %s", e.Service, e.StatusCode, e.Reason)
+	}
+	if e.Snippet != "" {
+		msg += fmt.Sprintf(" (received %q)", e.Snippet)
+	}
+	return msg
+}
+
+// CapabilityError is returned when the service can't do what is requested,
+// like compiling from a git repository.
+type CapabilityError struct {
+	Service string
+	Feature string
+}
+
+// Error provides the error interface for CapabilityError.
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("The %s service does not support %s.", e.Service, e.Feature)
+}
+
+// CheckSource returns a CapabilityError if the request has a Source
+// that is not one of the kinds supported by the service.
+func CheckSource(service string, req Request, kinds ...string) error {
+	if req.Source == nil || contains(kinds, req.Source.Kind()) {
+		return nil
+	}
+	return &CapabilityError{Service: service, Feature: req.Source.Kind() + " source"}
+}
+
+// Temporary checks if err is a problem of the service (and not of the document),
+// so it could disappear if we retry later or with another service.
+// Transport errors and 5xx protocol errors are temporary.
+func Temporary(err error) bool {
+	var terr *TransportError
+	if errors.As(err, &terr) {
+		return true
+	}
+	var perr *ProtocolError
+	if errors.As(err, &perr) {
+		return perr.StatusCode >= 500
+	}
+	return false
+}
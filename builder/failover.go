@@ -0,0 +1,69 @@
+package builder
+
+import (
+	"context"
+	"errors"
+)
+
+// failover is a Builder that tries several services in order.
+type failover struct {
+	services []Service
+}
+
+// NewFailover provides a Builder that tries the services in the given order.
+// The next service is used only if the current one fails with a temporary error
+// (a transport error or a 5xx answer), but not on a compilation error.
+// The services that do not support the requested compiler, biblio or source are skipped.
+// The request Url is used for the service named in the request Parameters,
+// the default Url is used for the others.
+func NewFailover(services ...Service) Builder {
+	return &failover{services: services}
+}
+
+// serviceRequest returns the request for the service s, or an error if s does not accept it.
+// The request Url is kept only for the service named in the request Parameters.
+func serviceRequest(s Service, req Request) (Request, error) {
+	if err := s.Accepts(req); err != nil {
+		req.Parameters.Log.Debug("Skip %s: %v", s.Name, err)
+		return req, err
+	}
+	if s.Name != req.Parameters.Service || req.Parameters.Url == "" {
+		req.Parameters.Url = s.Url
+	}
+	req.Parameters.Service = s.Name
+	return req, nil
+}
+
+// BuildPDF provides the Builder interface for failover.
+func (f *failover) BuildPDF(ctx context.Context, req Request) (*Result, error) {
+	var errs []error
+	tried := false
+	for _, s := range f.services {
+		sreq, err := serviceRequest(s, req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		req.Parameters.Log.Info("Try %s service.", s.Name)
+		// discard what the previous service has written
+		if tried && req.Sink != nil {
+			if err := req.Sink.Reset(); err != nil {
+				return nil, err
+			}
+		}
+		tried = true
+		res, err := s.New().BuildPDF(ctx, sreq)
+		if err == nil {
+			return res, nil
+		}
+		if ctx.Err() != nil || !Temporary(err) {
+			return nil, err
+		}
+		req.Parameters.Log.Info("The %s service failed: %v", s.Name, err)
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("No service to try.")
+	}
+	return nil, errors.Join(errs...)
+}
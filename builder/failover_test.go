@@ -0,0 +1,80 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/kpym/lol/log"
+)
+
+// fakeBuilder returns err, or a Result if err is nil.
+type fakeBuilder struct {
+	err   error
+	calls *[]string
+	name  string
+}
+
+func (f fakeBuilder) BuildPDF(ctx context.Context, req Request) (*Result, error) {
+	*f.calls = append(*f.calls, f.name+"@"+req.Parameters.Url)
+	if req.Sink != nil {
+		io.WriteString(req.Sink, f.name)
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &Result{Service: f.name}, nil
+}
+
+func TestFailover(t *testing.T) {
+	var calls []string
+	service := func(name string, compilers []string, err error) Service {
+		return Service{
+			Name:      name,
+			Url:       "default-" + name,
+			Compilers: compilers,
+			New:       func() Builder { return fakeBuilder{err: err, calls: &calls, name: name} },
+		}
+	}
+	down := &TransportError{Service: "down", Err: errors.New("connection refused")}
+	broken := &CompileError{Service: "broken", StatusCode: 400}
+	params := Parameters{Log: log.New(log.WithLevel(log.Quiet)), Compiler: "pdflatex", Service: "down", Url: "mine"}
+
+	// a temporary error goes to the next service, the incompatible one is skipped
+	f := NewFailover(
+		service("down", []string{"pdflatex"}, down),
+		service("xetex", []string{"xelatex"}, nil),
+		service("ok", []string{"pdflatex"}, nil),
+	)
+	res, err := f.BuildPDF(context.Background(), Request{Parameters: params})
+	if err != nil || res.Service != "ok" {
+		t.Errorf("Expected the ok service to answer, got %v (%v).", res, err)
+	}
+	if len(calls) != 2 || calls[0] != "down@mine" || calls[1] != "ok@default-ok" {
+		t.Errorf("Unexpected calls: %v", calls)
+	}
+
+	// the output of the failed service is discarded
+	sink := new(bufferSink)
+	f = NewFailover(
+		service("down", []string{"pdflatex"}, down),
+		service("ok", []string{"pdflatex"}, nil),
+	)
+	_, err = f.BuildPDF(context.Background(), Request{Parameters: params, Sink: sink})
+	if err != nil || sink.String() != "ok" {
+		t.Errorf("Expected only the ok service output, got %q (%v).", sink.String(), err)
+	}
+
+	// a compilation error stops the failover
+	calls = nil
+	f = NewFailover(
+		service("broken", []string{"pdflatex"}, broken),
+		service("ok", []string{"pdflatex"}, nil),
+	)
+	_, err = f.BuildPDF(context.Background(), Request{Parameters: params})
+	var comperr *CompileError
+	if !errors.As(err, &comperr) || len(calls) != 1 {
+		t.Errorf("Expected a single call with a compilation error, got %v (calls: %v).", err, calls)
+	}
+}
@@ -5,23 +5,36 @@
 // - target : containing the name of the main file
 // - compiler : containing the compiler (pdflatex|xelatex|lualatex)
 // - force : skip the cached version if present
+// For a git source, the server clones the repository instead:
+// a GET request is sent to /compile with the git (and branch) url parameters.
+// In the same way, for an url source a GET request is sent to /compile with the url parameter,
+// and a single small text file is sent as the text parameter (cacheable by the server).
 // In case of success the response body contains the pdf.
-// In case of error the response body contains the log.
+// In case of compilation error the status code is 400 and the response body contains the log.
 package laton
 
 import (
 	"archive/tar"
-	"bytes"
 	"compress/gzip"
-	"fmt"
+	"context"
+	"errors"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/kpym/lol/builder"
 )
 
+// serviceName is the name used to register the service.
+const serviceName = "laton"
+
+// maxQuerySize is the maximal size of the encoded url parameters when a single file is sent as text
+// (many servers refuse the request lines longer than 8 KB).
+const maxQuerySize = 6 * 1024
+
 // *laton is a Builder.
 type laton struct{}
 
@@ -30,12 +43,22 @@ func NewBuilder() builder.Builder {
 	return new(laton)
 }
 
-// filesToTar stock all source files in a single .tar.gz.
-func filesToTar(files builder.Files) ([]byte, error) {
+// register the laton service.
+func init() {
+	builder.Register(builder.Service{
+		Name:        serviceName,
+		Description: "latexonline.cc",
+		Url:         "https://texlive2020.latexonline.cc",
+		Compilers:   []string{"pdflatex", "xelatex", "lualatex"},
+		Sources:     []string{"git", "url"},
+		New:         NewBuilder,
+	})
+}
+
+// filesToTar writes all source files in a single .tar.gz to w.
+func filesToTar(w io.Writer, files builder.Files) error {
 	var err error
-	// .tar.gz buffer
-	var tarbuf bytes.Buffer
-	gzw := gzip.NewWriter(&tarbuf)
+	gzw := gzip.NewWriter(w)
 	tw := tar.NewWriter(gzw)
 
 	for name, data := range files {
@@ -48,91 +71,182 @@ func filesToTar(files builder.Files) ([]byte, error) {
 		// write header
 		err = tw.WriteHeader(hdr)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		// write file
 		_, err = tw.Write(data)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 	// close tar
 	err = tw.Close()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	// close gzip
-	err = gzw.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	return tarbuf.Bytes(), nil
+	return gzw.Close()
 }
 
-// newTarRequest prepare the http.Request to be send to latexonline.cc.
-// The values from params are encoded as url values and the tardata is send as request body.
-func newTarRequest(params builder.Parameters, tardata []byte) (*http.Request, error) {
-	// write the tar.gz as request body
-	body := new(bytes.Buffer)
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("file", "laton.tar.gz")
-	if err != nil {
-		return nil, err
-	}
-	part.Write(tardata)
-	err = writer.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	// encode the params values in the url
+// urlValues encodes the params values common to all requests.
+func urlValues(params builder.Parameters) url.Values {
 	urlParams := url.Values{}
 	urlParams.Add("target", params.Main)
 	if params.Force {
 		urlParams.Add("force", "true")
 	}
 	urlParams.Add("command", params.Compiler)
+	return urlParams
+}
+
+// newGitRequest prepare the http.Request asking latexonline.cc to compile a git repository.
+func newGitRequest(ctx context.Context, params builder.Parameters, src *builder.GitSource) (*http.Request, error) {
+	urlParams := urlValues(params)
+	urlParams.Add("git", src.Repo)
+	if src.Branch != "" {
+		urlParams.Add("branch", src.Branch)
+	}
+	return http.NewRequestWithContext(ctx, "GET", builder.BaseURL(params)+"/compile?"+urlParams.Encode(), nil)
+}
+
+// newURLRequest prepare the http.Request asking latexonline.cc to compile a file from its url.
+func newURLRequest(ctx context.Context, params builder.Parameters, src *builder.URLSource) (*http.Request, error) {
+	urlParams := urlValues(params)
+	urlParams.Del("target")
+	urlParams.Add("url", src.Url)
+	return http.NewRequestWithContext(ctx, "GET", builder.BaseURL(params)+"/compile?"+urlParams.Encode(), nil)
+}
+
+// textQuery returns the encoded url parameters sending the content of the main file as text,
+// if it is the only source and if it is a text small enough once encoded.
+func textQuery(req builder.Request) (string, bool) {
+	data, ok := req.Files[req.Parameters.Main]
+	if !ok || len(req.Files) != 1 || len(req.Parameters.Remote) > 0 {
+		return "", false
+	}
+	// the encoded text is never shorter
+	if len(data) > maxQuerySize || !utf8.Valid(data) {
+		return "", false
+	}
+	urlParams := urlValues(req.Parameters)
+	urlParams.Del("target")
+	urlParams.Add("text", string(data))
+	query := urlParams.Encode()
+	if len(query) > maxQuerySize {
+		return "", false
+	}
+	return query, true
+}
+
+// newTextRequest prepare the http.Request asking latexonline.cc to compile the text of a single file.
+func newTextRequest(ctx context.Context, params builder.Parameters, query string) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "GET", builder.BaseURL(params)+"/compile?"+query, nil)
+}
+
+// newTarRequest prepare the http.Request to be send to latexonline.cc.
+// The values from params are encoded as url values and the files are streamed
+// as a tar.gz in the multipart request body.
+func newTarRequest(ctx context.Context, params builder.Parameters, files builder.Files) (*http.Request, error) {
+	// write the tar.gz as request body
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		part, err := writer.CreateFormFile("file", "laton.tar.gz")
+		if err == nil {
+			err = filesToTar(part, files)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
 
 	// return the request
-	httpReq, err := http.NewRequest("POST", params.Url+"/data?"+urlParams.Encode(), body)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", builder.BaseURL(params)+"/data?"+urlValues(params).Encode(), pr)
 	if err != nil {
+		pr.Close()
 		return nil, err
 	}
 	httpReq.Header.Add("Content-Type", writer.FormDataContentType())
 	return httpReq, nil
 }
 
+// newRequest prepares the http.Request corresponding to the request source.
+func newRequest(ctx context.Context, req builder.Request) (*http.Request, error) {
+	switch src := req.Source.(type) {
+	case *builder.GitSource:
+		return newGitRequest(ctx, req.Parameters, src)
+	case *builder.URLSource:
+		return newURLRequest(ctx, req.Parameters, src)
+	}
+	if query, ok := textQuery(req); ok {
+		return newTextRequest(ctx, req.Parameters, query)
+	}
+	// latexonline.cc can't fetch the remote files, so we do it
+	req, err := builder.FetchRemote(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return newTarRequest(ctx, req.Parameters, req.Files)
+}
+
 // BuildPDF send the request to latexonline.cc and returns the resulting pdf.
-func (y *laton) BuildPDF(req builder.Request) ([]byte, error) {
-	var err error
-	// prepare the tar file to submit
-	tardata, err := filesToTar(req.Files)
+// The sources are uploaded as tar.gz (or as text for a single small file),
+// or fetched by the server for a git or an url source.
+// The request is aborted when ctx is done.
+func (y *laton) BuildPDF(ctx context.Context, req builder.Request) (*builder.Result, error) {
+	err := builder.CheckSource(serviceName, req, "git", "url")
+	if err != nil {
+		return nil, err
+	}
+	client, err := builder.NewClient(req.Parameters)
 	if err != nil {
 		return nil, err
 	}
 	// create a request
-	httpReq, err := newTarRequest(req.Parameters, tardata)
+	ctx, timing := builder.NewTiming(ctx)
+	httpReq, err := newRequest(ctx, req)
 	if err != nil {
 		return nil, err
 	}
 	// send compile request
-	client := &http.Client{}
 	resp, err := client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &builder.TransportError{Service: serviceName, Err: withoutQuery(err)}
 	}
 	defer resp.Body.Close()
 
-	// read pdf or error from response
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("Problem reading response: %w\n", err)
+	// in case of compilation error latexonline.cc answers with 400 and the log
+	if resp.StatusCode == http.StatusBadRequest {
+		respBody, err := builder.ReadAnswer(ctx, serviceName, resp)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &builder.CompileError{Service: serviceName, StatusCode: resp.StatusCode, Log: string(respBody)}
 	}
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, fmt.Errorf("Laton compilation error (status code %d):\n%s\n", resp.StatusCode, respBody)
+		return nil, &builder.ProtocolError{Service: serviceName, StatusCode: resp.StatusCode, Reason: http.StatusText(resp.StatusCode)}
 	}
 
-	// respBody contains the resulting pdf
-	return respBody, nil
+	// the response body contains the resulting pdf
+	res := &builder.Result{Service: serviceName}
+	err = builder.ReadPDFResponse(ctx, req, res, resp)
+	if err != nil {
+		return nil, err
+	}
+	timing.Fill(res)
+	return res, nil
+}
+
+// withoutQuery removes the url parameters from the url of the error,
+// because they can contain the whole document (or the credentials of a git repository).
+func withoutQuery(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		uerr.URL, _, _ = strings.Cut(uerr.URL, "?")
+	}
+	return err
 }
@@ -0,0 +1,84 @@
+package laton
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/builder/buildertest"
+)
+
+func TestConformance(t *testing.T) {
+	srv := buildertest.NewLaton()
+	defer srv.Close()
+	service, _ := builder.Lookup(serviceName)
+	buildertest.Run(t, service, srv)
+}
+
+func TestForce(t *testing.T) {
+	srv := buildertest.NewLaton()
+	defer srv.Close()
+	service, _ := builder.Lookup(serviceName)
+	req := buildertest.Request(service, srv.URL)
+	req.Parameters.Force = true
+	_, err := NewBuilder().BuildPDF(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !srv.Last().Force {
+		t.Errorf("The force parameter was not received.")
+	}
+}
+
+func TestSingleFile(t *testing.T) {
+	srv := buildertest.NewLaton()
+	defer srv.Close()
+	service, _ := builder.Lookup(serviceName)
+	req := buildertest.Request(service, srv.URL)
+	main := req.Files[req.Parameters.Main]
+	req.Files = builder.Files{req.Parameters.Main: main}
+
+	// a single small file is sent as text
+	_, err := NewBuilder().BuildPDF(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rec := srv.Last()
+	if rec.Main != "" || !bytes.Equal(rec.Files[""], main) {
+		t.Errorf("The single file was not sent as text: %q, %q", rec.Main, rec.Files)
+	}
+
+	// a big file is uploaded as tar.gz, even if it is small before encoding
+	for _, extra := range []string{"%\n", "\\{}", "é"} {
+		big := append(main, bytes.Repeat([]byte(extra), maxQuerySize/(3*len(extra)))...)
+		req.Files = builder.Files{req.Parameters.Main: big}
+		_, err = NewBuilder().BuildPDF(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		rec = srv.Last()
+		if rec.Main != req.Parameters.Main || !bytes.Equal(rec.Files[rec.Main], big) {
+			t.Errorf("The big file (%d bytes of %q) was not uploaded as tar.gz: %q", len(big), extra, rec.Main)
+		}
+	}
+}
+
+func TestErrorWithoutQuery(t *testing.T) {
+	srv := buildertest.NewLaton()
+	service, _ := builder.Lookup(serviceName)
+	req := buildertest.Request(service, srv.URL)
+	req.Files = builder.Files{req.Parameters.Main: []byte("\\documentclass{article}")}
+	// nobody listens anymore
+	srv.Close()
+	_, err := NewBuilder().BuildPDF(context.Background(), req)
+	var terr *builder.TransportError
+	if !errors.As(err, &terr) {
+		t.Fatalf("Expected a transport error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "documentclass") || strings.Contains(err.Error(), "?") {
+		t.Errorf("The url parameters are in the error: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+// local package provides a builder.Builder interface to the TeX installation on the PATH.
+// The request files are written in a temporary folder where:
+// - latexmk is used if present (and the compiler is not context),
+// - otherwise the compiler is run directly, followed by the bibliography tool
+// and as many reruns as needed.
+// In case of success the pdf is returned with the .log, .aux and .synctex.gz artifacts.
+// In case of error the .log file is returned in a builder.CompileError.
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kpym/lol/builder"
+)
+
+// serviceName is the name used to register the service.
+const serviceName = "local"
+
+// The maximal number of compiler runs without latexmk.
+const maxRuns = 4
+
+// *local is a Builder.
+type local struct{}
+
+// NewBuilder provides a new Builder interface to the local TeX installation.
+func NewBuilder() builder.Builder {
+	return new(local)
+}
+
+// register the local service.
+func init() {
+	builder.Register(builder.Service{
+		Name:        serviceName,
+		Description: "the TeX installation on the PATH, with latexmk if present",
+		Compilers:   []string{"pdflatex", "xelatex", "lualatex", "platex", "uplatex", "context"},
+		Biblios:     []string{"bibtex", "biber"},
+		Explicit:    true,
+		New:         NewBuilder,
+	})
+}
+
+// writeFiles saves all files in the dir folder.
+func writeFiles(dir string, files builder.Files) error {
+	for name, data := range files {
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("The file %s is outside of the project folder.", name)
+		}
+		fname := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(fname), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(fname, data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// job contains the state of a single local compilation.
+type job struct {
+	ctx    context.Context
+	params builder.Parameters
+	// the folder containing the main file
+	dir string
+	// the main file name (without folder) and its name without extension
+	main, base string
+	// the output of all commands
+	output bytes.Buffer
+}
+
+// run executes a command in the job folder.
+func (j *job) run(name string, args ...string) error {
+	cmd := exec.CommandContext(j.ctx, name, args...)
+	cmd.Dir = j.dir
+	cmd.Stdout = &j.output
+	cmd.Stderr = &j.output
+	j.params.Log.Debug("Run %s %s.", name, strings.Join(args, " "))
+	return cmd.Run()
+}
+
+// latexmkArgs returns the latexmk arguments to compile main with the parameters.
+func latexmkArgs(params builder.Parameters, main string) []string {
+	args := []string{"-interaction=nonstopmode", "-synctex=1"}
+	switch params.Compiler {
+	case "xelatex":
+		args = append(args, "-xelatex")
+	case "lualatex":
+		args = append(args, "-lualatex")
+	case "platex", "uplatex":
+		args = append(args, "-pdfdvi", "-latex="+params.Compiler+" %O %S", "-e", "$dvipdf='dvipdfmx %O -o %D %S'")
+	default:
+		args = append(args, "-pdf")
+	}
+	if params.Biblio != "" {
+		args = append(args, "-bibtex")
+	}
+	if params.Force {
+		args = append(args, "-g")
+	}
+	return append(args, main)
+}
+
+// latexmk compiles using latexmk.
+func (j *job) latexmk() error {
+	return j.run("latexmk", latexmkArgs(j.params, j.main)...)
+}
+
+// needRerun checks if the last log asks for a new run.
+func (j *job) needRerun() bool {
+	log, _ := os.ReadFile(filepath.Join(j.dir, j.base+".log"))
+	return bytes.Contains(log, []byte("Rerun to get")) || bytes.Contains(log, []byte("Rerun LaTeX"))
+}
+
+// engine compiles running the compiler (and the bibliography tool) directly.
+func (j *job) engine() error {
+	if j.params.Compiler == "context" {
+		return j.run("context", "--nonstopmode", "--synctex", j.main)
+	}
+	compile := func() error {
+		return j.run(j.params.Compiler, "-interaction=nonstopmode", "-synctex=1", j.main)
+	}
+	err := compile()
+	if err != nil {
+		return err
+	}
+	runs := 1
+	if j.params.Biblio != "" {
+		err = j.run(j.params.Biblio, j.base)
+		if err != nil {
+			return err
+		}
+		err = compile()
+		if err != nil {
+			return err
+		}
+		runs++
+	}
+	for ; runs < maxRuns && j.needRerun(); runs++ {
+		err = compile()
+		if err != nil {
+			return err
+		}
+	}
+	if j.params.Compiler == "platex" || j.params.Compiler == "uplatex" {
+		return j.run("dvipdfmx", j.base+".dvi")
+	}
+	return nil
+}
+
+// BuildPDF compiles the request in a temporary folder and returns the resulting pdf.
+// The compilation is killed when ctx is done.
+func (l *local) BuildPDF(ctx context.Context, req builder.Request) (*builder.Result, error) {
+	start := time.Now()
+	err := builder.CheckSource(serviceName, req)
+	if err != nil {
+		return nil, err
+	}
+	req, err = builder.FetchRemote(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	tmpdir, err := os.MkdirTemp("", "lol-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpdir)
+	err = writeFiles(tmpdir, req.Files)
+	if err != nil {
+		return nil, err
+	}
+	res := &builder.Result{Service: serviceName, Upload: time.Since(start)}
+
+	main := req.Parameters.Main
+	j := &job{
+		ctx:    ctx,
+		params: req.Parameters,
+		dir:    filepath.Join(tmpdir, filepath.FromSlash(path.Dir(main))),
+		main:   path.Base(main),
+		base:   strings.TrimSuffix(path.Base(main), path.Ext(main)),
+	}
+	if _, lerr := exec.LookPath("latexmk"); lerr == nil && req.Parameters.Compiler != "context" {
+		err = j.latexmk()
+	} else {
+		err = j.engine()
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("The local TeX installation is not usable: %w", err)
+	}
+
+	// collect the log and the artifacts
+	res.Artifacts = make(builder.Files)
+	for _, ext := range []string{".log", ".aux", ".synctex.gz"} {
+		data, rerr := os.ReadFile(filepath.Join(j.dir, j.base+ext))
+		if rerr == nil {
+			res.Artifacts[j.base+ext] = data
+		}
+	}
+	res.Log = string(res.Artifacts[j.base+".log"])
+	if res.Log == "" {
+		res.Log = j.output.String()
+	}
+	if err != nil {
+		code := 1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		}
+		return nil, &builder.CompileError{Service: serviceName, StatusCode: code, Log: res.Log}
+	}
+
+	pdf, err := os.Open(filepath.Join(j.dir, j.base+".pdf"))
+	if err != nil {
+		return nil, &builder.CompileError{Service: serviceName, Log: res.Log}
+	}
+	defer pdf.Close()
+	err = builder.ReadPDF(ctx, req, res, pdf)
+	if err != nil {
+		return nil, err
+	}
+	res.RoundTrip = time.Since(start)
+	return res, nil
+}
@@ -0,0 +1,193 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/log"
+)
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	err := writeFiles(dir, builder.Files{"main.tex": []byte("main"), "chapters/one.tex": []byte("one")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "chapters", "one.tex"))
+	if err != nil || string(data) != "one" {
+		t.Errorf("Wrong file chapters/one.tex: %q (error: %v)", data, err)
+	}
+
+	// the files can't be written outside of the folder
+	for _, name := range []string{"../main.tex", "chapters/../../main.tex", "/tmp/main.tex"} {
+		err := writeFiles(t.TempDir(), builder.Files{name: []byte("main")})
+		if err == nil {
+			t.Errorf("The file %s should be refused.", name)
+		}
+	}
+}
+
+func TestLatexmkArgs(t *testing.T) {
+	tests := []struct {
+		params   builder.Parameters
+		expected string
+	}{
+		{builder.Parameters{Compiler: "pdflatex"}, "-interaction=nonstopmode -synctex=1 -pdf main.tex"},
+		{builder.Parameters{Compiler: "xelatex", Biblio: "biber"}, "-interaction=nonstopmode -synctex=1 -xelatex -bibtex main.tex"},
+		{builder.Parameters{Compiler: "lualatex", Force: true}, "-interaction=nonstopmode -synctex=1 -lualatex -g main.tex"},
+		{builder.Parameters{Compiler: "uplatex"}, "-interaction=nonstopmode -synctex=1 -pdfdvi -latex=uplatex %O %S -e $dvipdf='dvipdfmx %O -o %D %S' main.tex"},
+	}
+	for _, test := range tests {
+		args := strings.Join(latexmkArgs(test.params, "main.tex"), " ")
+		if args != test.expected {
+			t.Errorf("Wrong latexmk arguments for %s:\n%s\nexpected:\n%s", test.params.Compiler, args, test.expected)
+		}
+	}
+}
+
+func TestNeedRerun(t *testing.T) {
+	dir := t.TempDir()
+	j := &job{dir: dir, base: "main"}
+	if j.needRerun() {
+		t.Errorf("No rerun is needed without log.")
+	}
+	tests := []struct {
+		log      string
+		expected bool
+	}{
+		{"Output written on main.pdf (1 page).", false},
+		{"LaTeX Warning: Label(s) may have changed. Rerun to get cross-references right.", true},
+		{"Package rerunfilecheck Warning: File `main.out' has changed.\n(rerunfilecheck) Rerun LaTeX.", true},
+	}
+	for _, test := range tests {
+		if err := os.WriteFile(filepath.Join(dir, "main.log"), []byte(test.log), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if j.needRerun() != test.expected {
+			t.Errorf("Wrong rerun for the log %q.", test.log)
+		}
+	}
+}
+
+// fakeTeX puts on the PATH fake commands that record their calls in the returned file.
+// The fake compilers ask for a rerun on their first run only.
+func fakeTeX(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake commands are shell scripts.")
+	}
+	bin := t.TempDir()
+	calls := filepath.Join(bin, "calls")
+	script := `#!/bin/sh
+echo "${0##*/} $*" >> ` + calls + `
+case "${0##*/}" in
+*latex)
+	for a; do main="$a"; done
+	log="${main%.tex}.log"
+	if [ -f "$log" ]; then echo "done" > "$log"; else echo "Rerun to get cross-references right." > "$log"; fi
+	;;
+esac
+`
+	for _, name := range []string{"pdflatex", "platex", "bibtex", "dvipdfmx", "context"} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+	return calls
+}
+
+func TestEngine(t *testing.T) {
+	calls := fakeTeX(t)
+	tests := []struct {
+		params   builder.Parameters
+		expected []string
+	}{
+		{builder.Parameters{Compiler: "pdflatex"}, []string{
+			"pdflatex -interaction=nonstopmode -synctex=1 main.tex",
+			"pdflatex -interaction=nonstopmode -synctex=1 main.tex",
+		}},
+		{builder.Parameters{Compiler: "pdflatex", Biblio: "bibtex"}, []string{
+			"pdflatex -interaction=nonstopmode -synctex=1 main.tex",
+			"bibtex main",
+			"pdflatex -interaction=nonstopmode -synctex=1 main.tex",
+		}},
+		{builder.Parameters{Compiler: "platex"}, []string{
+			"platex -interaction=nonstopmode -synctex=1 main.tex",
+			"platex -interaction=nonstopmode -synctex=1 main.tex",
+			"dvipdfmx main.dvi",
+		}},
+		{builder.Parameters{Compiler: "context"}, []string{
+			"context --nonstopmode --synctex main.tex",
+		}},
+	}
+	for _, test := range tests {
+		os.Remove(calls)
+		test.params.Log = log.New(log.WithLevel(log.Quiet))
+		j := &job{ctx: context.Background(), params: test.params, dir: t.TempDir(), main: "main.tex", base: "main"}
+		if err := j.engine(); err != nil {
+			t.Fatalf("Unexpected error for %s: %v\n%s", test.params.Compiler, err, j.output.String())
+		}
+		data, _ := os.ReadFile(calls)
+		got := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if strings.Join(got, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("Wrong commands for %s with %q:\n%s\nexpected:\n%s", test.params.Compiler, test.params.Biblio, strings.Join(got, "\n"), strings.Join(test.expected, "\n"))
+		}
+	}
+}
+
+// TestBuildPDF uses the real TeX installation (if any).
+func TestBuildPDF(t *testing.T) {
+	for _, name := range []string{"latexmk", "pdflatex"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("No %s on the PATH.", name)
+		}
+	}
+	service, _ := builder.Lookup(serviceName)
+	req := builder.Request{
+		Parameters: builder.Parameters{
+			Log:      log.New(log.WithLevel(log.Quiet)),
+			Service:  serviceName,
+			Compiler: "pdflatex",
+			Main:     "main.tex",
+		},
+		Files: builder.Files{
+			"main.tex":         []byte("\\documentclass{article}\n\\begin{document}\n\\input{chapters/one}\n\\end{document}\n"),
+			"chapters/one.tex": []byte("Hello world.\n"),
+		},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		res, err := service.New().BuildPDF(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !bytes.HasPrefix(res.PDF, []byte("%PDF-")) || res.Size != int64(len(res.PDF)) {
+			t.Errorf("Wrong pdf (%d bytes, size %d).", len(res.PDF), res.Size)
+		}
+		if _, ok := res.Artifacts["main.log"]; !ok {
+			t.Errorf("The log is not in the artifacts.")
+		}
+	})
+
+	t.Run("CompileError", func(t *testing.T) {
+		req := req
+		req.Files = builder.Files{"main.tex": []byte("\\documentclass{article}\n\\begin{document}\n\\undefinedcommand\n\\end{document}\n")}
+		_, err := service.New().BuildPDF(context.Background(), req)
+		var compileErr *builder.CompileError
+		if !errors.As(err, &compileErr) {
+			t.Fatalf("Expected a compile error, got %v", err)
+		}
+		if !strings.Contains(compileErr.Log, "Undefined control sequence") {
+			t.Errorf("The log is not in the error:\n%s", compileErr.Log)
+		}
+	})
+}
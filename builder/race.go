@@ -0,0 +1,92 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// race is a Builder that sends the same request to several services at once.
+type race struct {
+	services []Service
+}
+
+// NewRace provides a Builder that sends the request to all services at once
+// and returns the first successful result (the other requests are canceled).
+// The services are skipped and their Url is chosen as with NewFailover.
+func NewRace(services ...Service) Builder {
+	return &race{services: services}
+}
+
+// raceAnswer is the answer of a single service in the race.
+type raceAnswer struct {
+	service  string
+	res      *Result
+	err      error
+	duration time.Duration
+}
+
+// BuildPDF provides the Builder interface for race.
+func (r *race) BuildPDF(ctx context.Context, req Request) (*Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	answers := make(chan raceAnswer)
+	var errs []error
+	running := 0
+	for _, s := range r.services {
+		sreq, err := serviceRequest(s, req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// no Sink: the services can't write to it at the same time (the winner's PDF is returned)
+		sreq.Sink = nil
+		running++
+		go func(s Service, sreq Request) {
+			start := time.Now()
+			res, err := s.New().BuildPDF(ctx, sreq)
+			answers <- raceAnswer{service: s.Name, res: res, err: err, duration: time.Since(start)}
+		}(s, sreq)
+	}
+	if running == 0 {
+		if len(errs) == 0 {
+			return nil, errors.New("No service to race.")
+		}
+		return nil, errors.Join(errs...)
+	}
+	req.Parameters.Log.Info("Race between %d services.", running)
+
+	// wait for all answers (the remaining ones are canceled once we have a winner)
+	var winner *Result
+	var comperr error
+	for ; running > 0; running-- {
+		a := <-answers
+		switch {
+		case winner != nil:
+			req.Parameters.Log.Info("The %s service stopped after %1.1f seconds.", a.service, a.duration.Seconds())
+		case a.err == nil:
+			winner = a.res
+			cancel()
+			req.Parameters.Log.Info("The %s service won the race in %1.1f seconds.", a.service, a.duration.Seconds())
+		default:
+			req.Parameters.Log.Info("The %s service failed after %1.1f seconds: %v", a.service, a.duration.Seconds(), a.err)
+			var ce *CompileError
+			if comperr == nil && errors.As(a.err, &ce) {
+				comperr = a.err
+			}
+			errs = append(errs, a.err)
+		}
+	}
+	if winner != nil {
+		return winner, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	// a compilation error is more useful than the problems of the other services
+	if comperr != nil {
+		return nil, comperr
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kpym/lol/log"
+)
+
+// slowBuilder answers after delay (or when ctx is done).
+type slowBuilder struct {
+	name  string
+	delay time.Duration
+	err   error
+}
+
+func (s slowBuilder) BuildPDF(ctx context.Context, req Request) (*Result, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &Result{Service: s.name}, nil
+}
+
+func TestRace(t *testing.T) {
+	service := func(name string, delay time.Duration, err error) Service {
+		return Service{
+			Name:      name,
+			Compilers: []string{"pdflatex"},
+			New:       func() Builder { return slowBuilder{name: name, delay: delay, err: err} },
+		}
+	}
+	params := Parameters{Log: log.New(log.WithLevel(log.Quiet)), Compiler: "pdflatex"}
+	down := &TransportError{Service: "down", Err: errors.New("connection refused")}
+
+	r := NewRace(
+		service("slow", time.Minute, nil),
+		service("down", 0, down),
+		service("fast", 10*time.Millisecond, nil),
+	)
+	start := time.Now()
+	res, err := r.BuildPDF(context.Background(), Request{Parameters: params})
+	if err != nil || res.Service != "fast" {
+		t.Errorf("Expected the fast service to win, got %v (%v).", res, err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("The slow service was not canceled.")
+	}
+
+	// all services fail: the compilation error is returned
+	broken := &CompileError{Service: "broken", StatusCode: 400}
+	r = NewRace(service("down", 0, down), service("broken", 10*time.Millisecond, broken))
+	_, err = r.BuildPDF(context.Background(), Request{Parameters: params})
+	if err != broken {
+		t.Errorf("Expected the compilation error, got %v.", err)
+	}
+}
@@ -0,0 +1,126 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Service describes a backend that can be registered.
+type Service struct {
+	// Name is the (lower case) name used to select the service, like "laton".
+	Name string
+	// Description is a short text displayed in the help message.
+	Description string
+	// Url is the default base url, used when Parameters.Url is empty.
+	Url string
+	// Compilers lists the supported compilers (the first one is the preferred).
+	Compilers []string
+	// Biblios lists the supported bibliography tools (can be empty).
+	Biblios []string
+	// Sources lists the supported Source kinds (like "git").
+	Sources []string
+	// Explicit services are used only when requested by name (never chosen automatically).
+	Explicit bool
+	// New creates a new Builder for this service.
+	New func() Builder
+}
+
+// Supports checks if the service can build with compiler and biblio.
+// An empty biblio means that no bibliography tool is requested.
+func (s Service) Supports(compiler, biblio string) error {
+	if !contains(s.Compilers, compiler) {
+		return fmt.Errorf("%s do not support %s compiler.", s.Name, compiler)
+	}
+	if biblio != "" && !contains(s.Biblios, biblio) {
+		return fmt.Errorf("%s do not support %s bibliography.", s.Name, biblio)
+	}
+	return nil
+}
+
+// Accepts checks if the service can build the request
+// (compiler, biblio and source).
+func (s Service) Accepts(req Request) error {
+	err := s.Supports(req.Parameters.Compiler, req.Parameters.Biblio)
+	if err != nil {
+		return err
+	}
+	if req.Source != nil && !contains(s.Sources, req.Source.Kind()) {
+		return &CapabilityError{Service: s.Name, Feature: req.Source.Kind() + " source"}
+	}
+	return nil
+}
+
+// contains checks if str is one of the values.
+func contains(values []string, str string) bool {
+	for _, v := range values {
+		if str == v {
+			return true
+		}
+	}
+	return false
+}
+
+// the registered services by name
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Service)
+)
+
+// Register makes a service available by its name.
+// It is meant to be called from the init function of the backend package.
+// Register panics if the name is empty or already used, or if New is nil.
+func Register(s Service) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	s.Name = strings.ToLower(s.Name)
+	if s.Name == "" {
+		panic("builder: Register with an empty service name")
+	}
+	if s.New == nil {
+		panic("builder: Register with a nil New for service " + s.Name)
+	}
+	if _, dup := registry[s.Name]; dup {
+		panic("builder: Register called twice for service " + s.Name)
+	}
+	registry[s.Name] = s
+}
+
+// Lookup returns the service registered with this name (if any).
+func Lookup(name string) (Service, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	s, ok := registry[strings.ToLower(name)]
+	return s, ok
+}
+
+// Services returns all registered services sorted by name.
+func Services() []Service {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	services := make([]Service, 0, len(registry))
+	for _, s := range registry {
+		services = append(services, s)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
+
+// Names returns the names of all registered services sorted alphabetically.
+func Names() []string {
+	var names []string
+	for _, s := range Services() {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// New creates a Builder for the service registered with this name.
+func New(name string) (Builder, error) {
+	s, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("Unknown %s service.", name)
+	}
+	return s.New(), nil
+}
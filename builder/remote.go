@@ -0,0 +1,63 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// FetchRemote downloads the Parameters.Remote files and returns a copy of req
+// with these files added to Files (the local files with the same name are kept).
+// It is used by the services that can't fetch the remote files themselves.
+func FetchRemote(ctx context.Context, req Request) (Request, error) {
+	if len(req.Parameters.Remote) == 0 {
+		return req, nil
+	}
+	client, err := NewClient(req.Parameters)
+	if err != nil {
+		return req, err
+	}
+	files := make(Files, len(req.Files)+len(req.Parameters.Remote))
+	for name, data := range req.Files {
+		files[name] = data
+	}
+	for _, r := range req.Parameters.Remote {
+		if _, ok := files[r.Path]; ok {
+			req.Parameters.Log.Debug("Remote file %s is present locally, %s is not fetched.", r.Path, r.Url)
+			continue
+		}
+		data, err := fetch(ctx, client, r.Url, int64(req.Parameters.MaxSize)*megabyte)
+		if err != nil {
+			return req, fmt.Errorf("Can't fetch the remote file %s: %w", r.Path, err)
+		}
+		req.Parameters.Log.Debug("Remote file %s (%d bytes) fetched from %s.", r.Path, len(data), r.Url)
+		files[r.Path] = data
+	}
+	req.Files = files
+	return req, nil
+}
+
+// fetch downloads the content at url, up to max bytes (no limit if 0).
+func fetch(ctx context.Context, client *http.Client, url string, max int64) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	if max <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err == nil && int64(len(data)) > max {
+		return nil, fmt.Errorf("the file is bigger than %d MB", max/megabyte)
+	}
+	return data, err
+}
@@ -0,0 +1,178 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// megabyte is the unit of Parameters.MaxSize.
+const megabyte = 1 << 20
+
+// sinkWriter remembers the write errors,
+// to distinguish them from the read errors in io.Copy.
+type sinkWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Write provides the io.Writer interface for sinkWriter.
+func (s *sinkWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err != nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// ReadPDF copies the pdf from body to req.Sink, or to res.PDF if there is no sink.
+// The copy stops with a ProtocolError if the pdf is bigger than Parameters.MaxSize.
+// The answer is checked to be a pdf (starting with %PDF- and ending with %%EOF),
+// otherwise a ProtocolError with a snippet of the answer is returned.
+// The read errors are TransportErrors (or the context error if ctx is done).
+func ReadPDF(ctx context.Context, req Request, res *Result, body io.Reader) error {
+	return readPDF(ctx, req, res, body, 0)
+}
+
+// ReadPDFResponse checks the Content-Type of the http answer and reads its pdf with ReadPDF.
+func ReadPDFResponse(ctx context.Context, req Request, res *Result, resp *http.Response) error {
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if ct != "" && !pdfTypes[ct] {
+		head, _ := io.ReadAll(io.LimitReader(resp.Body, snippetSize))
+		return &ProtocolError{Service: res.Service, StatusCode: resp.StatusCode, Reason: "the answer is " + ct + " instead of a pdf", Snippet: snippet(head)}
+	}
+	return readPDF(ctx, req, res, resp.Body, resp.StatusCode)
+}
+
+// MaxAnswerSize limits the answers that are not pdf files (errors, logs, json status).
+const MaxAnswerSize = 16 * megabyte
+
+// ReadAnswer reads the body of an http answer that is not a pdf (error, log, json status).
+// An answer bigger than MaxAnswerSize is a ProtocolError.
+// The read errors are TransportErrors (or the context error if ctx is done).
+// The body is not closed.
+func ReadAnswer(ctx context.Context, service string, resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxAnswerSize+1))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &TransportError{Service: service, Err: fmt.Errorf("problem reading response: %w", err)}
+	}
+	if len(body) > MaxAnswerSize {
+		return nil, &ProtocolError{Service: service, StatusCode: resp.StatusCode, Reason: fmt.Sprintf("the answer is bigger than %d MB", MaxAnswerSize/megabyte)}
+	}
+	return body, nil
+}
+
+// readPDF is ReadPDF with the status code to use in the errors.
+func readPDF(ctx context.Context, req Request, res *Result, body io.Reader, status int) error {
+	var buf *bytes.Buffer
+	sink := &sinkWriter{w: req.Sink}
+	if req.Sink == nil {
+		buf = new(bytes.Buffer)
+		sink.w = buf
+	}
+	max := int64(req.Parameters.MaxSize) * megabyte
+	if max > 0 {
+		body = io.LimitReader(body, max+1)
+	}
+	checker := new(pdfChecker)
+	n, err := io.Copy(io.MultiWriter(checker, sink), body)
+	if sink.err != nil {
+		return fmt.Errorf("Can't write the pdf: %w", sink.err)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &TransportError{Service: res.Service, Err: fmt.Errorf("problem reading response: %w", err)}
+	}
+	if max > 0 && n > max {
+		return &ProtocolError{Service: res.Service, StatusCode: status, Reason: fmt.Sprintf("the pdf is bigger than %d MB", req.Parameters.MaxSize)}
+	}
+	if reason := checker.check(); reason != "" {
+		return &ProtocolError{Service: res.Service, StatusCode: status, Reason: reason, Snippet: snippet(checker.head)}
+	}
+	res.Size = n
+	if buf != nil {
+		res.PDF = buf.Bytes()
+	}
+	return nil
+}
+
+// pdf checks constants
+const (
+	pdfMagic   = "%PDF-"
+	pdfTrailer = "%%EOF"
+	// The magic should be in the first bytes and the trailer in the last bytes.
+	pdfCheckSize = 1024
+	// The size of the snippet of an unexpected answer.
+	snippetSize = 200
+)
+
+// pdfTypes are the Content-Types accepted for a pdf.
+var pdfTypes = map[string]bool{
+	"application/pdf":          true,
+	"application/x-pdf":        true,
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+}
+
+// pdfChecker keeps the beginning and the end of the data written to it, to check if it is a pdf.
+type pdfChecker struct {
+	head []byte
+	tail []byte
+}
+
+// Write provides the io.Writer interface for pdfChecker.
+func (c *pdfChecker) Write(p []byte) (int, error) {
+	if n := pdfCheckSize - len(c.head); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		c.head = append(c.head, p[:n]...)
+	}
+	if len(p) >= pdfCheckSize {
+		c.tail = append(c.tail[:0], p[len(p)-pdfCheckSize:]...)
+	} else {
+		c.tail = append(c.tail, p...)
+		if extra := len(c.tail) - pdfCheckSize; extra > 0 {
+			c.tail = c.tail[:copy(c.tail, c.tail[extra:])]
+		}
+	}
+	return len(p), nil
+}
+
+// check returns the reason why the data is not a pdf ("" if it looks like a pdf).
+func (c *pdfChecker) check() string {
+	if !bytes.Contains(c.head, []byte(pdfMagic)) {
+		return "the answer is not a pdf"
+	}
+	if !bytes.Contains(c.tail, []byte(pdfTrailer)) {
+		return "the pdf is truncated (no " + pdfTrailer + " at the end)"
+	}
+	return ""
+}
+
+// snippet returns the beginning of data as a printable string.
+func snippet(data []byte) string {
+	if len(data) > snippetSize {
+		data = data[:snippetSize]
+	}
+	return strings.ToValidUTF8(string(data), "\uFFFD")
+}
+
+// PipeBody returns a reader that streams what write writes (in a goroutine).
+// The write error (if any) is returned by the reader.
+func PipeBody(write func(w io.Writer) error) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(write(pw))
+	}()
+	return pr
+}
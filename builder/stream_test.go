@@ -0,0 +1,118 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kpym/lol/log"
+)
+
+// bufferSink is a Sink in memory.
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (b *bufferSink) Reset() error {
+	b.Buffer.Reset()
+	return nil
+}
+
+func TestReadPDF(t *testing.T) {
+	pdf := "%PDF-1.5\n" + strings.Repeat("0", megabyte/2) + "\n%%EOF\n"
+
+	// without sink the pdf is in the result
+	res := &Result{Service: "fake"}
+	err := ReadPDF(context.Background(), Request{}, res, strings.NewReader(pdf))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(res.PDF) != pdf || res.Size != int64(len(pdf)) {
+		t.Errorf("Wrong pdf in the result (%d bytes).", res.Size)
+	}
+
+	// with sink the pdf is written to it
+	sink := new(bufferSink)
+	res = &Result{Service: "fake"}
+	err = ReadPDF(context.Background(), Request{Sink: sink}, res, strings.NewReader(pdf))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.PDF != nil || sink.String() != pdf || res.Size != int64(len(pdf)) {
+		t.Errorf("The pdf was not written to the sink (%d bytes).", res.Size)
+	}
+
+	// the size can be limited
+	req := Request{Parameters: Parameters{MaxSize: 1}}
+	err = ReadPDF(context.Background(), req, &Result{Service: "fake"}, strings.NewReader(pdf))
+	if err != nil {
+		t.Errorf("A pdf smaller than MaxSize should be accepted: %v", err)
+	}
+	err = ReadPDF(context.Background(), req, &Result{Service: "fake"}, strings.NewReader(pdf+pdf))
+	var perr *ProtocolError
+	if !errors.As(err, &perr) {
+		t.Errorf("Expected a ProtocolError for a pdf bigger than MaxSize, got %T: %v", err, err)
+	}
+
+	// the answer should be a pdf
+	html := "<html><body>Please login</body></html>"
+	err = ReadPDF(context.Background(), Request{}, &Result{Service: "fake"}, strings.NewReader(html))
+	if !errors.As(err, &perr) || perr.Snippet != html {
+		t.Errorf("Expected a ProtocolError with the html, got %T: %v", err, err)
+	}
+	err = ReadPDF(context.Background(), Request{}, &Result{Service: "fake"}, strings.NewReader(pdf[:len(pdf)-10]))
+	if !errors.As(err, &perr) || !strings.Contains(perr.Reason, "truncated") {
+		t.Errorf("Expected a ProtocolError for a truncated pdf, got %T: %v", err, err)
+	}
+}
+
+func TestReadAnswer(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusBadRequest, Body: io.NopCloser(strings.NewReader("! Undefined control sequence."))}
+	body, err := ReadAnswer(context.Background(), "fake", resp)
+	if err != nil || string(body) != "! Undefined control sequence." {
+		t.Errorf("Wrong answer %q (error: %v)", body, err)
+	}
+
+	// a too big answer is not read
+	resp.Body = io.NopCloser(io.LimitReader(zeros{}, MaxAnswerSize+10))
+	_, err = ReadAnswer(context.Background(), "fake", resp)
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) {
+		t.Errorf("Expected a protocol error, got %v", err)
+	}
+}
+
+func TestFetchRemoteMaxSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, io.LimitReader(zeros{}, 2*megabyte))
+	}))
+	defer srv.Close()
+
+	req := Request{Parameters: Parameters{
+		Log:    log.New(log.WithLevel(log.Quiet)),
+		Remote: []RemoteFile{{Path: "big.pdf", Url: srv.URL}},
+	}}
+	got, err := FetchRemote(context.Background(), req)
+	if err != nil || len(got.Files["big.pdf"]) != 2*megabyte {
+		t.Errorf("Without limit the remote file should be fetched (error: %v).", err)
+	}
+	req.Parameters.MaxSize = 1
+	if _, err := FetchRemote(context.Background(), req); err == nil {
+		t.Errorf("The remote file bigger than MaxSize should be refused.")
+	}
+}
+
+// zeros is an infinite reader of zeros.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -0,0 +1,51 @@
+package builder
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing measures the upload and the round trip durations of a http request.
+type Timing struct {
+	mu    sync.Mutex
+	start time.Time
+	wrote time.Time
+}
+
+// NewTiming starts the timing.
+// The returned context should be used for the http request to measure the upload.
+func NewTiming(ctx context.Context) (context.Context, *Timing) {
+	t := &Timing{start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			t.wrote = time.Now()
+			t.mu.Unlock()
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), t
+}
+
+// Upload returns the time needed to send the request
+// (or the time elapsed until now if the request is not fully sent).
+func (t *Timing) Upload() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.wrote.IsZero() {
+		return time.Since(t.start)
+	}
+	return t.wrote.Sub(t.start)
+}
+
+// RoundTrip returns the time elapsed since the start.
+func (t *Timing) RoundTrip() time.Duration {
+	return time.Since(t.start)
+}
+
+// Fill sets the Upload and RoundTrip durations of res.
+func (t *Timing) Fill(res *Result) {
+	res.Upload = t.Upload()
+	res.RoundTrip = t.RoundTrip()
+}
@@ -0,0 +1,177 @@
+package ytotech
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/kpym/lol/builder"
+)
+
+// The asynchronous builds use the following endpoints:
+// - POST /builds with the same json as /builds/sync, answers with the build id,
+// - GET /builds/{id} answers with the build status (and the logs when done),
+// - GET /builds/{id}/output.pdf answers with the pdf when the build succeeded.
+
+// polling constants
+const (
+	// The first delay between two status requests.
+	pollInterval = time.Second
+	// The delay is doubled after each request, up to this value.
+	maxPollInterval = 10 * time.Second
+)
+
+// The possible build status.
+const (
+	statusPending = "pending"
+	statusRunning = "running"
+	statusSuccess = "success"
+	statusFailure = "failure"
+)
+
+// buildStatus is the json answer of POST /builds and GET /builds/{id}.
+type buildStatus struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Logs   string `json:"logs"`
+}
+
+// Submit sends the request to POST /builds and returns the build id.
+func (y *ytotech) Submit(ctx context.Context, req builder.Request) (string, error) {
+	err := builder.CheckSource(serviceName, req, "url")
+	if err != nil {
+		return "", err
+	}
+	resp, err := send(ctx, req, "/builds")
+	if err != nil {
+		return "", err
+	}
+	respBody, err := readBody(ctx, resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", answerToError(resp, respBody)
+	}
+	var status buildStatus
+	err = json.Unmarshal(respBody, &status)
+	if err != nil || status.Id == "" {
+		return "", &builder.ProtocolError{Service: serviceName, StatusCode: resp.StatusCode, Reason: "the answer does not contain a build id"}
+	}
+	return status.Id, nil
+}
+
+// buildUrl returns the url of the build (with an optional suffix).
+func buildUrl(params builder.Parameters, id, suffix string) string {
+	return builder.BaseURL(params) + "/builds/" + url.PathEscape(id) + suffix
+}
+
+// status returns the current status of the build.
+func status(ctx context.Context, client *http.Client, params builder.Parameters, id string) (*buildStatus, error) {
+	resp, respBody, err := get(ctx, client, buildUrl(params, id, ""))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &builder.ProtocolError{Service: serviceName, StatusCode: resp.StatusCode, Reason: "unknown build " + id}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, answerToError(resp, respBody)
+	}
+	var s buildStatus
+	err = json.Unmarshal(respBody, &s)
+	if err != nil {
+		return nil, &builder.ProtocolError{Service: serviceName, StatusCode: resp.StatusCode, Reason: "the build status is not a valid json"}
+	}
+	return &s, nil
+}
+
+// Fetch polls the status of the build until it is done and returns the resulting pdf.
+// The progress is reported through params.Log.
+func (y *ytotech) Fetch(ctx context.Context, params builder.Parameters, id string) (*builder.Result, error) {
+	return fetch(ctx, builder.Request{Parameters: params}, id)
+}
+
+// fetch polls the status of the build until it is done and reads the resulting pdf
+// (to req.Sink if not nil).
+func fetch(ctx context.Context, req builder.Request, id string) (*builder.Result, error) {
+	params := req.Parameters
+	client, err := builder.NewClient(params)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	interval := pollInterval
+	last := ""
+	for {
+		s, err := status(ctx, client, params, id)
+		if err != nil {
+			return nil, err
+		}
+		if s.Status != last {
+			params.Log.Info("Build %s status: %s (after %1.0f seconds).", id, s.Status, time.Since(start).Seconds())
+			last = s.Status
+		} else {
+			params.Log.Debug("Build %s status: still %s.", id, s.Status)
+		}
+		switch s.Status {
+		case statusSuccess:
+			httpReq, err := http.NewRequestWithContext(ctx, "GET", buildUrl(params, id, "/output.pdf"), nil)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := open(ctx, client, httpReq)
+			if err != nil {
+				return nil, err
+			}
+			res, err := answerToResult(ctx, req, resp)
+			if err != nil {
+				return nil, err
+			}
+			res.Log = s.Logs
+			res.RoundTrip = time.Since(start)
+			return res, nil
+		case statusFailure:
+			if s.Logs == "" {
+				return nil, &builder.ProtocolError{Service: serviceName, Reason: "build failed: " + s.Error}
+			}
+			return nil, &builder.CompileError{Service: serviceName, Log: s.Logs}
+		case statusPending, statusRunning:
+		default:
+			return nil, &builder.ProtocolError{Service: serviceName, Reason: "unknown build status " + s.Status}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > maxPollInterval {
+			interval = maxPollInterval
+		}
+	}
+}
+
+// buildAsync submits the request and waits for the result.
+func (y *ytotech) buildAsync(ctx context.Context, req builder.Request) (*builder.Result, error) {
+	start := time.Now()
+	id, err := y.Submit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	upload := time.Since(start)
+	req.Parameters.Log.Info("Build %s submitted.", id)
+	res, err := fetch(ctx, req, id)
+	if ctx.Err() != nil {
+		req.Parameters.Log.Info("The build %s can still be fetched with: lol fetch %s", id, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.Upload = upload
+	res.RoundTrip = time.Since(start)
+	return res, nil
+}
@@ -0,0 +1,130 @@
+package ytotech
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// resource cache constants
+const (
+	// The smaller files are always uploaded.
+	minCachedSize = 1024
+	// We forget the uploaded resources after this duration.
+	hashTTL = 7 * 24 * time.Hour
+)
+
+// hashOf returns the (hex encoded) sha256 of data.
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// knownHashes remembers the resources already uploaded to each server (by url).
+// It is persisted in the user cache folder.
+type knownHashes struct {
+	fname   string
+	Servers map[string]map[string]time.Time `json:"servers"`
+}
+
+// loadKnownHashes reads the uploaded resources list
+// (an empty list is returned in case of problem).
+func loadKnownHashes() *knownHashes {
+	k := &knownHashes{Servers: make(map[string]map[string]time.Time)}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return k
+	}
+	k.fname = filepath.Join(dir, "lol", "ytotech-resources.json")
+	data, err := os.ReadFile(k.fname)
+	if err == nil {
+		json.Unmarshal(data, k)
+	}
+	if k.Servers == nil {
+		k.Servers = make(map[string]map[string]time.Time)
+	}
+	// forget the old uploads
+	for _, hashes := range k.Servers {
+		for hash, uploaded := range hashes {
+			if time.Since(uploaded) > hashTTL {
+				delete(hashes, hash)
+			}
+		}
+	}
+	return k
+}
+
+// has checks if the resource was uploaded to the server at url.
+func (k *knownHashes) has(url, hash string) bool {
+	_, ok := k.Servers[url][hash]
+	return ok
+}
+
+// add remembers that the resources are uploaded to the server at url.
+func (k *knownHashes) add(url string, hashes ...string) {
+	if k.Servers[url] == nil {
+		k.Servers[url] = make(map[string]time.Time)
+	}
+	now := time.Now()
+	for _, hash := range hashes {
+		k.Servers[url][hash] = now
+	}
+}
+
+// remove forgets the resources (when the server reports them missing).
+func (k *knownHashes) remove(url string, hashes ...string) {
+	for _, hash := range hashes {
+		delete(k.Servers[url], hash)
+	}
+}
+
+// save writes the uploaded resources list.
+func (k *knownHashes) save() error {
+	if k.fname == "" {
+		return nil
+	}
+	data, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(k.fname), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(k.fname, data, 0644)
+}
+
+// resourceCache is the resource cache state of a single build.
+type resourceCache struct {
+	url   string
+	known *knownHashes
+	// the hashes of the files (by name)
+	hashes map[string]string
+	// send everything (when the server does not tell what is missing)
+	all bool
+}
+
+// newResourceCache computes the hashes of files (sent to the server at url).
+func newResourceCache(url string, files map[string][]byte) *resourceCache {
+	rc := &resourceCache{url: url, known: loadKnownHashes(), hashes: make(map[string]string, len(files))}
+	for name, data := range files {
+		rc.hashes[name] = hashOf(data)
+	}
+	return rc
+}
+
+// cached checks if the content of the file can be omitted.
+func (rc *resourceCache) cached(name string, size int) bool {
+	return !rc.all && size >= minCachedSize && rc.known.has(rc.url, rc.hashes[name])
+}
+
+// uploaded remembers that the server has all files now.
+func (rc *resourceCache) uploaded() error {
+	for _, hash := range rc.hashes {
+		rc.known.add(rc.url, hash)
+	}
+	return rc.known.save()
+}
@@ -4,32 +4,51 @@
 //
 //	{
 //	    "compiler": "pdflatex",
+//	    "options": {
+//	        "compiler": {"halt_on_error": true},
+//	        "bibliography": {"command": "biber"},
+//	        "response": {"log_files_on_failure": true}
+//	    },
 //	    "resources": [
 //	        {
 //	            "main": true,
-//	            "file": "...base64 encoded file..."
+//	            "path": "main.tex",
+//	            "content": "...plain text file..."
 //	        },
 //	        {
 //	            "path": "logo.png",
 //	            "file": "...base64 encoded file..."
+//	        },
+//	        {
+//	            "path": "corporate.cls",
+//	            "url": "https://example.com/corporate.cls"
 //	        }
 //	    ]
 //	}
 //
 // ```
+// The options are present only if requested.
 package ytotech
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/kpym/lol/builder"
 )
 
+// serviceName is the name used to register the service.
+const serviceName = "ytotech"
+
 // *ytotech is a Builder.
 type ytotech struct{}
 
@@ -38,68 +57,421 @@ func NewBuilder() builder.Builder {
 	return new(ytotech)
 }
 
-// reqToJson encode (part of) the Request as json that is send to latex.ytotech.com.
-func reqToJson(req builder.Request) string {
-	json := new(strings.Builder)
-	json.WriteString(`{`)
-	fmt.Fprintf(json, `"compiler":"%s",`, req.Parameters.Compiler)
-	if req.Parameters.Biblio != "" {
-		fmt.Fprintf(json, `"options":{"bibliography":{"command":"%s"}},`, req.Parameters.Biblio)
+// register the ytotech service.
+func init() {
+	builder.Register(builder.Service{
+		Name:        serviceName,
+		Description: "latex-on-http",
+		Url:         "https://latex.ytotech.com",
+		Compilers:   []string{"pdflatex", "xelatex", "lualatex", "platex", "uplatex", "context"},
+		Biblios:     []string{"bibtex", "biber"},
+		Sources:     []string{"url"},
+		New:         NewBuilder,
+	})
+}
+
+// request is the json sent to latex-on-http.
+type request struct {
+	Compiler  string     `json:"compiler"`
+	Options   *options   `json:"options,omitempty"`
+	Resources []resource `json:"resources"`
+}
+
+// options are the optional compilation parameters.
+type options struct {
+	Compiler     *compilerOptions     `json:"compiler,omitempty"`
+	Bibliography *bibliographyOptions `json:"bibliography,omitempty"`
+	Response     *responseOptions     `json:"response,omitempty"`
+}
+
+// compilerOptions are the options of the compiler.
+type compilerOptions struct {
+	// stop at the first error
+	HaltOnError bool `json:"halt_on_error,omitempty"`
+}
+
+// bibliographyOptions are the options of the bibliography tool.
+type bibliographyOptions struct {
+	// bibtex or biber
+	Command string `json:"command"`
+}
+
+// responseOptions are the options of the answer.
+type responseOptions struct {
+	// return all log files (as zip) on failure
+	LogFilesOnFailure bool `json:"log_files_on_failure,omitempty"`
+}
+
+// resource is a single source file.
+// The main resource is compiled and its path is relative to the project root
+// (so the main file can be in a subfolder).
+// The data is sent as plain text in Content for (valid utf-8) text files,
+// and base64 encoded in File for the others.
+// The remote files are sent as Url (and fetched by the server).
+// With the resource cache, the Hash of the data is always sent,
+// and the data is omitted if the server should already have it.
+// The File is the last field, so it can be streamed by writeTo.
+type resource struct {
+	Main    bool   `json:"main,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Content string `json:"content,omitempty"`
+	Url     string `json:"url,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+	File    []byte `json:"file,omitempty"`
+}
+
+// writeTo writes the resource as json to w.
+// The File is base64 encoded on the fly, to avoid a copy of the whole file in memory.
+func (r resource) writeTo(w io.Writer) error {
+	file := r.File
+	r.File = nil
+	data, err := json.Marshal(r)
+	if err != nil || len(file) == 0 {
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		return err
+	}
+	// replace the final } by the file field
+	data = data[:len(data)-1]
+	if len(data) > 1 {
+		data = append(data, ',')
+	}
+	data = append(data, `"file":"`...)
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	enc := base64.NewEncoder(base64.StdEncoding, w)
+	if _, err = enc.Write(file); err != nil {
+		return err
+	}
+	if err = enc.Close(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, `"}`)
+	return err
+}
+
+// textExtensions are the files that can be sent as plain text.
+var textExtensions = map[string]bool{
+	".tex": true, ".sty": true, ".cls": true, ".bib": true, ".bst": true,
+	".bbx": true, ".cbx": true, ".def": true, ".cfg": true, ".clo": true,
+	".ltx": true, ".txt": true, ".csv": true, ".dtx": true, ".ins": true,
+}
+
+// newResource prepares the resource of a single file.
+// With the resource cache (rc not nil), the hash is added
+// and the data is omitted if the server already has it.
+func newResource(name string, data []byte, main bool, rc *resourceCache) resource {
+	r := resource{Main: main, Path: name}
+	if rc != nil {
+		r.Hash = rc.hashes[name]
+		if !main && rc.cached(name, len(data)) {
+			return r
+		}
+	}
+	if textExtensions[strings.ToLower(path.Ext(name))] && utf8.Valid(data) {
+		r.Content = string(data)
+	} else {
+		r.File = data
+	}
+	return r
+}
+
+// newRequest converts the Request to the latex-on-http request.
+// The resource cache rc can be nil.
+func newRequest(req builder.Request, rc *resourceCache) *request {
+	params := req.Parameters
+	yreq := &request{Compiler: params.Compiler}
+
+	var opts options
+	if params.HaltOnError {
+		opts.Compiler = &compilerOptions{HaltOnError: true}
+	}
+	if params.Biblio != "" {
+		opts.Bibliography = &bibliographyOptions{Command: params.Biblio}
+	}
+	if params.LogFiles {
+		opts.Response = &responseOptions{LogFilesOnFailure: true}
+	}
+	if opts != (options{}) {
+		yreq.Options = &opts
+	}
+
+	// sort the files to get a reproducible json
+	names := make([]string, 0, len(req.Files))
+	for fname := range req.Files {
+		names = append(names, fname)
+	}
+	sort.Strings(names)
+	for _, fname := range names {
+		yreq.Resources = append(yreq.Resources, newResource(fname, req.Files[fname], fname == params.Main, rc))
+	}
+	// the main file of an url source is fetched by the server
+	if src, ok := req.Source.(*builder.URLSource); ok {
+		yreq.Resources = append(yreq.Resources, resource{Main: true, Path: params.Main, Url: src.Url})
+	}
+	// the remote files are fetched by the server (the local files with the same name are kept)
+	for _, r := range params.Remote {
+		if _, ok := req.Files[r.Path]; !ok {
+			yreq.Resources = append(yreq.Resources, resource{Main: r.Path == params.Main, Path: r.Path, Url: r.Url})
+		}
+	}
+
+	return yreq
+}
+
+// writeJson streams (part of) the Request as json that is send to latex.ytotech.com.
+// The resources are written one by one, so the json is never fully in memory.
+func writeJson(w io.Writer, req builder.Request, rc *resourceCache) error {
+	yreq := newRequest(req, rc)
+	resources := yreq.Resources
+	yreq.Resources = nil
+	head, err := json.Marshal(yreq)
+	if err != nil {
+		return err
+	}
+	// replace "resources":null} by the streamed resources
+	head = bytes.TrimSuffix(head, []byte("null}"))
+	if _, err = w.Write(append(head, '[')); err != nil {
+		return err
 	}
-	json.WriteString(`"resources": [`)
-	addComma := false
-	for fname, fdata := range req.Files {
-		if addComma {
-			json.WriteString(`,`)
-		} else {
-			addComma = true
+	for i, r := range resources {
+		if i > 0 {
+			if _, err = io.WriteString(w, ","); err != nil {
+				return err
+			}
 		}
-		if fname == req.Parameters.Main {
-			json.WriteString(`{"main": true,`)
-		} else {
-			fmt.Fprintf(json, `{"path": "%s",`, fname)
+		if err = r.writeTo(w); err != nil {
+			return err
 		}
-		json.WriteString(`"file": "`)
-		json.WriteString(base64.StdEncoding.EncodeToString(fdata))
-		json.WriteString(`"}`)
 	}
-	json.WriteString(`]}`)
+	_, err = io.WriteString(w, "]}")
+	return err
+}
 
-	return json.String()
+// reqToJson encode (part of) the Request as json that is send to latex.ytotech.com.
+func reqToJson(req builder.Request, rc *resourceCache) ([]byte, error) {
+	var buf bytes.Buffer
+	err := writeJson(&buf, req, rc)
+	return buf.Bytes(), err
 }
 
 // compilationError corresponds to the json returned in case of error.
+// When some resources sent by hash are not in the server cache,
+// the status code is 406 and the missing resources are listed.
 type compilationError struct {
-	Error string
-	Logs  string
+	Error     string
+	Logs      string
+	Resources []resource
 }
 
-// BuildPDF send the request to latex.ytotech.com and returns the resulting pdf.
-func (y *ytotech) BuildPDF(req builder.Request) ([]byte, error) {
-	// prepare the json to submit
-	body := strings.NewReader(reqToJson(req))
-	// send comile request
-	resp, err := http.Post(req.Parameters.Url+"/builds/sync", "application/json", body)
+// zipToError extracts the .log files from the zip returned with log_files_on_failure.
+func zipToError(status int, data []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
-		return nil, err
+		return &builder.ProtocolError{Service: serviceName, StatusCode: status, Reason: "the answer is not a valid zip"}
+	}
+	comperr := &builder.CompileError{Service: serviceName, StatusCode: status}
+	for _, f := range zr.File {
+		if path.Ext(f.Name) != ".log" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		log, err := io.ReadAll(io.LimitReader(rc, builder.MaxAnswerSize))
+		rc.Close()
+		if err == nil {
+			comperr.Log += string(log)
+		}
+	}
+	return comperr
+}
+
+// open sends the http request and returns the answer, with the body not read yet.
+// The body should be closed by the caller.
+func open(ctx context.Context, client *http.Client, httpReq *http.Request) (*http.Response, error) {
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &builder.TransportError{Service: serviceName, Err: err}
 	}
+	return resp, nil
+}
+
+// readBody reads (and closes) the body of the answer (up to builder.MaxAnswerSize).
+func readBody(ctx context.Context, resp *http.Response) ([]byte, error) {
 	defer resp.Body.Close()
+	return builder.ReadAnswer(ctx, serviceName, resp)
+}
+
+// do sends the http request and returns the answer.
+func do(ctx context.Context, client *http.Client, httpReq *http.Request) (*http.Response, []byte, error) {
+	resp, err := open(ctx, client, httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	respBody, err := readBody(ctx, resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, respBody, nil
+}
+
+// post streams the json written by write to the url and returns the answer (with the body not read yet).
+func post(ctx context.Context, client *http.Client, url string, write func(w io.Writer) error) (*http.Response, error) {
+	body := builder.PipeBody(write)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	httpReq.Header.Add("Content-Type", "application/json")
+	return open(ctx, client, httpReq)
+}
+
+// get requests the url and returns the answer.
+func get(ctx context.Context, client *http.Client, url string) (*http.Response, []byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return do(ctx, client, httpReq)
+}
+
+// missingResources returns the hashes of the resources that are not in the server cache
+// (if the answer is a cache miss).
+func missingResources(resp *http.Response, respBody []byte) ([]string, bool) {
+	if resp.StatusCode != http.StatusNotAcceptable {
+		return nil, false
+	}
+	var comperr compilationError
+	if json.Unmarshal(respBody, &comperr) != nil {
+		return nil, false
+	}
+	var hashes []string
+	for _, r := range comperr.Resources {
+		hashes = append(hashes, r.Hash)
+	}
+	return hashes, true
+}
 
-	// read pdf or error from response
-	respBody, err := io.ReadAll(resp.Body)
+// send streams the request to the endpoint and returns the answer (with the body not read yet).
+// With the resource cache, the resources already uploaded are sent by hash.
+// If the server reports missing resources, the request is sent again with their content.
+func send(ctx context.Context, req builder.Request, endpoint string) (*http.Response, error) {
+	client, err := builder.NewClient(req.Parameters)
 	if err != nil {
-		return nil, fmt.Errorf("Problem reading response: %w\n", err)
+		return nil, err
 	}
+	var rc *resourceCache
+	if req.Parameters.ResourceCache {
+		rc = newResourceCache(req.Parameters.Url, req.Files)
+	}
+	write := func(w io.Writer) error {
+		return writeJson(w, req, rc)
+	}
+
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		resp, err = post(ctx, client, builder.BaseURL(req.Parameters)+endpoint, write)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusNotAcceptable || rc == nil || attempt > 0 {
+			break
+		}
+		respBody, err := readBody(ctx, resp)
+		if err != nil {
+			return nil, err
+		}
+		missing, miss := missingResources(resp, respBody)
+		if !miss {
+			// not a cache miss, the body is given back to the caller
+			resp.Body = io.NopCloser(bytes.NewReader(respBody))
+			break
+		}
+		req.Parameters.Log.Info("%d resources are not in the server cache, send them again.", len(missing))
+		if len(missing) == 0 {
+			// we do not know which ones, so we send everything
+			rc.all = true
+		}
+		rc.known.remove(rc.url, missing...)
+	}
+	if rc != nil && resp.StatusCode < 500 && resp.StatusCode != http.StatusNotAcceptable {
+		if err := rc.uploaded(); err != nil {
+			req.Parameters.Log.Debug("Can't save the resource cache: %v", err)
+		}
+	}
+	return resp, nil
+}
+
+// BuildPDF send the request to latex.ytotech.com and returns the resulting pdf.
+// If req.Parameters.Async is set, the build is submitted and its status is polled
+// (instead of waiting for the answer of /builds/sync).
+// The request is aborted when ctx is done.
+func (y *ytotech) BuildPDF(ctx context.Context, req builder.Request) (*builder.Result, error) {
+	err := builder.CheckSource(serviceName, req, "url")
+	if err != nil {
+		return nil, err
+	}
+	if req.Parameters.Async {
+		return y.buildAsync(ctx, req)
+	}
+	ctx, timing := builder.NewTiming(ctx)
+	resp, err := send(ctx, req, "/builds/sync")
+	if err != nil {
+		return nil, err
+	}
+	res, err := answerToResult(ctx, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	timing.Fill(res)
+	return res, nil
+}
+
+// answerToResult reads the pdf from the answer (or the error).
+func answerToResult(ctx context.Context, req builder.Request, resp *http.Response) (*builder.Result, error) {
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		// respBody contains a json encoded compilationError
-		var comperr compilationError
-		err = json.Unmarshal(respBody, &comperr)
+		respBody, err := readBody(ctx, resp)
 		if err != nil {
-			return nil, fmt.Errorf("YtoTech compilation error (status code %d). The answer is not a valid json:\n%s\n", resp.StatusCode, respBody)
+			return nil, err
 		}
-		return nil, fmt.Errorf("YtoTech compilation error (status code %d):\n%s\n", resp.StatusCode, comperr.Logs)
+		return nil, answerToError(resp, respBody)
 	}
+	defer resp.Body.Close()
 
-	// respBody contains the resulting pdf
-	return respBody, nil
+	// the response body contains the resulting pdf
+	res := &builder.Result{Service: serviceName}
+	err := builder.ReadPDFResponse(ctx, req, res, resp)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// answerToError converts an answer with error status code to the corresponding error.
+func answerToError(resp *http.Response, respBody []byte) error {
+	if resp.StatusCode >= 500 {
+		return &builder.ProtocolError{Service: serviceName, StatusCode: resp.StatusCode, Reason: http.StatusText(resp.StatusCode)}
+	}
+	// with log_files_on_failure the log files are zipped
+	if resp.Header.Get("Content-Type") == "application/zip" {
+		return zipToError(resp.StatusCode, respBody)
+	}
+	// respBody contains a json encoded compilationError
+	var comperr compilationError
+	err := json.Unmarshal(respBody, &comperr)
+	if err != nil {
+		return &builder.ProtocolError{Service: serviceName, StatusCode: resp.StatusCode, Reason: "the answer is not a valid json"}
+	}
+	if comperr.Logs == "" {
+		return &builder.ProtocolError{Service: serviceName, StatusCode: resp.StatusCode, Reason: comperr.Error}
+	}
+	return &builder.CompileError{Service: serviceName, StatusCode: resp.StatusCode, Log: comperr.Logs}
 }
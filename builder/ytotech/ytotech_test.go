@@ -0,0 +1,120 @@
+package ytotech
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kpym/lol/builder"
+	"github.com/kpym/lol/builder/buildertest"
+)
+
+func TestConformance(t *testing.T) {
+	srv := buildertest.NewYtotech()
+	defer srv.Close()
+	service, _ := builder.Lookup(serviceName)
+	buildertest.Run(t, service, srv)
+}
+
+func TestReqToJson(t *testing.T) {
+	req := builder.Request{
+		Parameters: builder.Parameters{
+			Compiler:    "lualatex",
+			Biblio:      "biber",
+			HaltOnError: true,
+			Main:        "sub/main.tex",
+		},
+		Files: builder.Files{
+			"sub/main.tex": []byte("é \"quoted\""),
+			"logo.png":     {0, 1, 2},
+		},
+	}
+	data, err := reqToJson(req, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `{"compiler":"lualatex","options":{"compiler":{"halt_on_error":true},"bibliography":{"command":"biber"}},` +
+		`"resources":[{"path":"logo.png","file":"AAEC"},{"main":true,"path":"sub/main.tex","content":"é \"quoted\""}]}`
+	if string(data) != expected {
+		t.Errorf("Wrong json:\n%s\nexpected:\n%s", data, expected)
+	}
+}
+
+func TestResourceCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	srv := buildertest.NewYtotech()
+	defer srv.Close()
+	service, _ := builder.Lookup(serviceName)
+	req := buildertest.Request(service, srv.URL)
+	req.Parameters.ResourceCache = true
+	req.Files["big.pdf"] = bytes.Repeat([]byte{1, 2, 3}, 1000)
+
+	build := func(cached []string) {
+		t.Helper()
+		_, err := NewBuilder().BuildPDF(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		rec := srv.Last()
+		if fmt.Sprint(rec.Cached) != fmt.Sprint(cached) {
+			t.Errorf("Expected %v sent by hash, got %v.", cached, rec.Cached)
+		}
+		if !bytes.Equal(rec.Files["big.pdf"], req.Files["big.pdf"]) {
+			t.Errorf("Wrong content for big.pdf.")
+		}
+	}
+	// the first time everything is uploaded
+	build(nil)
+	// the second time the big file is sent by hash
+	build([]string{"big.pdf"})
+	// if the server forgets it, it is uploaded again
+	srv.ForgetResources()
+	build(nil)
+	build([]string{"big.pdf"})
+}
+
+func TestAsync(t *testing.T) {
+	srv := buildertest.NewYtotech()
+	defer srv.Close()
+	service, _ := builder.Lookup(serviceName)
+	req := buildertest.Request(service, srv.URL)
+	req.Parameters.Async = true
+
+	// success after some polling
+	srv.SetResponse(buildertest.Response{Delay: 100 * time.Millisecond})
+	res, err := NewBuilder().BuildPDF(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(res.PDF, buildertest.SamplePDF) {
+		t.Errorf("Wrong pdf: %q", res.PDF)
+	}
+
+	// compilation error
+	srv.SetResponse(buildertest.Response{Log: "! Undefined control sequence."})
+	_, err = NewBuilder().BuildPDF(context.Background(), req)
+	var comperr *builder.CompileError
+	if !errors.As(err, &comperr) || comperr.Log != "! Undefined control sequence." {
+		t.Errorf("Expected a compilation error, got %v.", err)
+	}
+
+	// submit and fetch later
+	srv.SetResponse(buildertest.Response{})
+	async := NewBuilder().(builder.AsyncBuilder)
+	id, err := async.Submit(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res, err = async.Fetch(context.Background(), req.Parameters, id)
+	if err != nil || !bytes.Equal(res.PDF, buildertest.SamplePDF) {
+		t.Errorf("Can't fetch the pdf: %v", err)
+	}
+	_, err = async.Fetch(context.Background(), req.Parameters, "unknown")
+	var perr *builder.ProtocolError
+	if !errors.As(err, &perr) {
+		t.Errorf("Expected a protocol error for an unknown build, got %v.", err)
+	}
+}
@@ -0,0 +1,192 @@
+// ignore package matches file names against rules in gitignore syntax:
+// - blank lines and lines starting with # are skipped (\# and \! escape these characters),
+// - a rule starting with ! re-includes the files excluded by the previous rules,
+// - a rule ending with / matches only folders,
+// - a rule with a / at the beginning or in the middle is relative to the base folder,
+// otherwise it matches a name at any depth,
+// - *, ? and [...] match inside a name, and ** matches any number of folders.
+// As in git, the files in an excluded folder can't be re-included.
+package ignore
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// rule is a single line of a gitignore file.
+type rule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher contains a list of rules.
+// The zero value excludes nothing.
+type Matcher struct {
+	rules []rule
+}
+
+// New returns a Matcher with these rules.
+func New(lines ...string) *Matcher {
+	m := new(Matcher)
+	m.Add(lines...)
+	return m
+}
+
+// Add appends the rules to the matcher (the last matching rule wins).
+// The invalid rules are ignored.
+func (m *Matcher) Add(lines ...string) {
+	for _, line := range lines {
+		if r, ok := parse(line); ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+}
+
+// AddFile appends the rules of a gitignore file.
+func (m *Matcher) AddFile(fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.AddReader(f)
+}
+
+// AddReader appends the rules read from r (one by line).
+func (m *Matcher) AddReader(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m.Add(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Match checks if the file (or the folder if dir is true) name is excluded.
+// The name is in unix style and relative to the base folder.
+// The parent folders are checked too.
+func (m *Matcher) Match(name string, dir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	name = strings.TrimPrefix(path.Clean(name), "./")
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(name, dir)
+}
+
+// match checks the rules for name only (without the parent folders).
+func (m *Matcher) match(name string, dir bool) bool {
+	excluded := false
+	for _, r := range m.rules {
+		if r.dirOnly && !dir {
+			continue
+		}
+		if r.re.MatchString(name) {
+			excluded = !r.negate
+		}
+	}
+	return excluded
+}
+
+// parse converts a gitignore line to a rule.
+func parse(line string) (rule, bool) {
+	var r rule
+	// the trailing spaces are ignored, unless escaped
+	line = strings.TrimRight(line, " \t\r")
+	if strings.HasSuffix(line, "\\") {
+		line += " "
+	}
+	if line == "" || line[0] == '#' {
+		return r, false
+	}
+	if line[0] == '!' {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return r, false
+	}
+	// without a / the rule matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if !anchored && !strings.HasPrefix(line, "**") {
+		line = "**/" + line
+	}
+	re, err := regexp.Compile("^" + toRegexp(line) + "$")
+	if err != nil {
+		return r, false
+	}
+	r.re = re
+	return r, true
+}
+
+// toRegexp converts a glob pattern (with **) to a regular expression.
+func toRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			// any number of folders (including none)
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			// everything inside
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// Escape returns a rule matching exactly the file name (relative to the base folder).
+func Escape(name string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	for _, c := range strings.TrimPrefix(path.Clean(name), "./") {
+		if strings.ContainsRune(`\*?[!# `, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	m := New("*.aux", "build/", "/main.pdf", "!keep.aux")
+	err := m.AddReader(strings.NewReader(`
+# comment
+\#notes.txt
+figs/**/*.svg
+drafts/**
+!drafts/final.tex
+doc/*.bak
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		dir      bool
+		expected bool
+	}{
+		{"main.aux", false, true},
+		{"ch/one.aux", false, true},
+		{"keep.aux", false, false},
+		{"main.tex", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"build/main.tex", false, true},
+		{"src/build/x.tex", false, true},
+		{"main.pdf", false, true},
+		{"./main.pdf", false, true},
+		{"out/main.pdf", false, false},
+		{"#notes.txt", false, true},
+		{"comment", false, false},
+		{"figs/a.svg", false, true},
+		{"figs/ch1/ch2/a.svg", false, true},
+		{"figs/a.png", false, false},
+		{"drafts/old.tex", false, true},
+		// can't re-include a file of an excluded folder,
+		// but drafts/** excludes the content, not the folder
+		{"drafts/final.tex", false, false},
+		{"doc/a.bak", false, true},
+		{"doc/sub/a.bak", false, false},
+	}
+	for _, test := range tests {
+		if got := m.Match(test.name, test.dir); got != test.expected {
+			t.Errorf("Match(%q, %v) = %v, expected %v", test.name, test.dir, got, test.expected)
+		}
+	}
+
+	var empty *Matcher
+	if empty.Match("main.aux", false) {
+		t.Errorf("A nil Matcher should exclude nothing.")
+	}
+}
@@ -1,26 +1,118 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/kpym/lol/app"
 	"github.com/kpym/lol/builder"
-	"github.com/kpym/lol/builder/laton"
-	"github.com/kpym/lol/builder/ytotech"
+	_ "github.com/kpym/lol/builder/laton"
+	_ "github.com/kpym/lol/builder/local"
+	_ "github.com/kpym/lol/builder/ytotech"
 	"github.com/kpym/lol/log"
+	"github.com/kpym/lol/texlog"
 	"github.com/spf13/pflag"
 )
 
 // Error checking
 func check(logger log.Logger, err error) {
 	if err != nil {
-		logger.Error(err.Error())
+		logger.Error("%s", err)
+		var comperr *builder.CompileError
+		if errors.As(err, &comperr) {
+			showLog(logger, comperr.Log)
+		}
 		os.Exit(1)
 	}
 }
 
+// showLog displays a summary of the compilation log.
+// The errors are always shown, the warnings only in verbose mode
+// and the full log only in debug mode.
+func showLog(logger log.Logger, rawlog string) {
+	logger.Debug("Compilation log:\n%s", rawlog)
+	texLog := texlog.Parse(rawlog)
+	if len(texLog.Entries) == 0 {
+		logger.Error("No error found in the log (use --debug to see it).")
+		return
+	}
+	for _, e := range texLog.Entries {
+		if e.Kind == texlog.Error {
+			logger.Error("%s", e)
+		} else {
+			logger.Info("%s: %s", e.Kind, e)
+		}
+	}
+	logger.Error("Log summary: %s.", texLog.Summary())
+}
+
+// output is the pdf file while it is written.
+// The pdf is streamed to a temporary file next to name, that is renamed at the end.
+// This way name is never left half-written.
+// It is a builder.Sink.
+type output struct {
+	*os.File
+	name string
+}
+
+// createOutput creates the temporary file for name.
+func createOutput(name string) (*output, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".lol-*.pdf")
+	if err != nil {
+		return nil, err
+	}
+	return &output{File: tmp, name: name}, nil
+}
+
+// Reset discards everything written so far.
+func (o *output) Reset() error {
+	err := o.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = o.Seek(0, io.SeekStart)
+	return err
+}
+
+// discard removes the temporary file.
+func (o *output) discard() {
+	o.Close()
+	os.Remove(o.File.Name())
+}
+
+// commit renames the temporary file to the output name.
+func (o *output) commit() error {
+	err := o.Chmod(0644)
+	if cerr := o.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(o.File.Name(), o.name)
+	}
+	if err != nil {
+		os.Remove(o.File.Name())
+	}
+	return err
+}
+
+// ctxError converts the context errors to user friendly messages.
+func ctxError(err error, timeout time.Duration) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("Build aborted: no answer after %v.", timeout)
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("Build canceled.")
+	}
+	return err
+}
+
 func main() {
 	var err error
 	var params builder.Parameters
@@ -30,39 +122,84 @@ func main() {
 	pflag.CommandLine.SortFlags = false
 	app.InitFlags()
 
+	// cancel the service selection and the build on Ctrl-C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+
 	// get parameters from flags, envs and config file
-	err = app.GetParameters(&params)
+	err = app.GetParameters(ctx, &params)
 	check(params.Log, err)
+	command, args := app.GetCommand()
 
 	// get the files content based on params.Patterns
-	files, err := app.GetFiles(params)
-	check(params.Log, err)
+	// (not needed if the service gets the sources by itself)
+	var files builder.Files
+	source := app.GetSource(params)
+	if command != app.FetchCommand && source == nil {
+		files, err = app.GetFiles(params)
+		check(params.Log, err)
+	}
+
+	// the timeout includes the service selection
+	if params.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(params.Timeout))
+		defer cancel()
+	}
 
 	// build the pdf
-	var compiler builder.Builder
-	switch params.Service {
-	case "ytotech":
-		compiler = ytotech.NewBuilder()
-	case "laton":
-		compiler = laton.NewBuilder()
-	default:
-		check(params.Log, fmt.Errorf("Unknown service %s", params.Service))
+	compiler, err := app.NewBuilder(params)
+	check(params.Log, err)
+	req := builder.Request{Parameters: params, Files: files, Source: source}
+
+	// the pdf is streamed to the output file
+	var out *output
+	if params.Output != "" && command != app.SubmitCommand {
+		out, err = createOutput(params.Output)
+		check(params.Log, err)
+		req.Sink = out
 	}
-	req := builder.Request{Parameters: params, Files: files}
-	params.Log.Info("Send request with the following parameters:\n%s", req.String())
 	sendtime := time.Now()
-	pdf, err := compiler.BuildPDF(req)
+	var res *builder.Result
+	switch command {
+	case app.SubmitCommand:
+		params.Log.Info("Submit request with the following parameters:\n%s", req.String())
+		id, err := compiler.(builder.AsyncBuilder).Submit(ctx, req)
+		check(params.Log, ctxError(err, params.Timeout))
+		params.Log.Info("Build submitted, fetch it with: lol fetch -s %s %s", params.Service, id)
+		fmt.Println(id)
+		return
+	case app.FetchCommand:
+		params.Log.Info("Fetch the build %s from %s.", args[0], params.Service)
+		res, err = compiler.(builder.AsyncBuilder).Fetch(ctx, params, args[0])
+	default:
+		params.Log.Info("Send request with the following parameters:\n%s", req.String())
+		res, err = compiler.BuildPDF(ctx, req)
+	}
 	params.Log.Info("Answer received in %1.1f seconds.", time.Since(sendtime).Seconds())
-	check(params.Log, err)
+	// do not write anything if we were interrupted in the meantime
+	if err == nil {
+		err = ctx.Err()
+	}
+	// the pdf may not be streamed (like with the race)
+	if err == nil && out != nil && res.PDF != nil {
+		_, err = out.Write(res.PDF)
+	}
+	if err != nil && out != nil {
+		out.discard()
+	}
+	check(params.Log, ctxError(err, params.Timeout))
+	params.Log.Debug("Build result:\n%s", res.String())
 
 	// write the pdf
-	if params.Output != "" {
+	if out != nil {
 		params.Log.Info("Write %s.", params.Output)
-		err = os.WriteFile(params.Output, pdf, 0644)
+		err = out.commit()
 		check(params.Log, err)
 	} else {
 		params.Log.Info("Write to stdout.")
-		_, err = os.Stdout.Write(pdf)
+		_, err = os.Stdout.Write(res.PDF)
 		check(params.Log, err)
 	}
 }
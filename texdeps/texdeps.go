@@ -0,0 +1,303 @@
+// texdeps package finds the local files needed to compile a LaTeX document.
+// It scans the main file (and recursively the found .tex, .sty and .cls files) for:
+// - \input, \include, \subfile,
+// - \includegraphics (honoring \graphicspath and guessing the extension), \includepdf, \includesvg,
+// - \bibliography, \addbibresource, \bibliographystyle,
+// - \usepackage, \RequirePackage, \documentclass, \LoadClass (only the local ones),
+// - \lstinputlisting, \verbatiminput, \inputminted.
+// As TeX does, all names are relative to the folder of the main file.
+package texdeps
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// kind tells how to find the file of a command argument.
+type kind int
+
+const (
+	// a tex file (.tex is added if there is no extension)
+	texFile kind = iota
+	// an image (the extension is guessed)
+	graphicFile
+	// a file used as it is
+	plainFile
+	// a comma separated list of .bib files
+	bibFiles
+	// a .bst file
+	bstFile
+	// a comma separated list of packages (optional .sty files)
+	styFiles
+	// a class (optional .cls file)
+	clsFile
+)
+
+// command describes a command that uses a file.
+type command struct {
+	kind kind
+	// the file is the n-th argument (1 if 0)
+	arg int
+	// the extension added if there is none
+	ext string
+}
+
+// commands are the commands that use files.
+var commands = map[string]command{
+	"input":             {kind: texFile},
+	"include":           {kind: texFile},
+	"subfile":           {kind: texFile},
+	"includegraphics":   {kind: graphicFile},
+	"includepdf":        {kind: plainFile, ext: ".pdf"},
+	"includesvg":        {kind: graphicFile, ext: ".svg"},
+	"lstinputlisting":   {kind: plainFile},
+	"verbatiminput":     {kind: plainFile},
+	"inputminted":       {kind: plainFile, arg: 2},
+	"bibliography":      {kind: bibFiles},
+	"addbibresource":    {kind: plainFile},
+	"bibliographystyle": {kind: bstFile},
+	"usepackage":        {kind: styFiles},
+	"RequirePackage":    {kind: styFiles},
+	"documentclass":     {kind: clsFile},
+	"LoadClass":         {kind: clsFile},
+}
+
+// graphicExtensions are tried (in this order) for an image without extension.
+var graphicExtensions = []string{".pdf", ".png", ".jpg", ".jpeg", ".eps", ".ps", ".mps", ".jbig2", ".jb2"}
+
+// scanner keeps the state of the scan.
+type scanner struct {
+	fsys fs.FS
+	// the folder of the main file
+	dir string
+	// the folders of \graphicspath
+	graphicspath []string
+	// the files already found (or scanned)
+	seen map[string]bool
+	// the results
+	found   []string
+	missing []string
+}
+
+// Find returns the files used by the main file (with this content) that exist in fsys,
+// and the names of the required files (not packages or classes) that are missing.
+// The main file itself is not in the found files.
+func Find(fsys fs.FS, main string, content []byte) (found, missing []string) {
+	s := &scanner{
+		fsys: fsys,
+		dir:  path.Dir(main),
+		seen: map[string]bool{path.Clean(main): true},
+	}
+	s.scan(string(content))
+	return s.found, s.missing
+}
+
+// scan looks for the commands in the content of a file.
+func (s *scanner) scan(content string) {
+	content = StripComments(content)
+	for i := 0; i < len(content); i++ {
+		if content[i] != '\\' {
+			continue
+		}
+		name := commandName(content[i+1:])
+		i += len(name)
+		if name == "graphicspath" {
+			arg, _ := arguments(content[i+1:], 1)
+			s.graphicspath = append(s.graphicspath, groups(arg)...)
+			continue
+		}
+		cmd, ok := commands[name]
+		if !ok {
+			continue
+		}
+		n := cmd.arg
+		if n == 0 {
+			n = 1
+		}
+		arg, ok := arguments(content[i+1:], n)
+		if !ok && name == "input" {
+			// \input file (without braces)
+			if fields := strings.Fields(content[i+1:]); len(fields) > 0 {
+				arg = fields[0]
+			}
+		}
+		arg = strings.TrimSpace(arg)
+		if arg == "" || strings.ContainsAny(arg, "\\#") {
+			continue
+		}
+		s.use(cmd, arg)
+	}
+}
+
+// use finds the file(s) used by the command with argument arg.
+func (s *scanner) use(cmd command, arg string) {
+	switch cmd.kind {
+	case texFile:
+		s.add(candidates(arg, ".tex", ""), arg)
+	case graphicFile:
+		var names []string
+		for _, dir := range append([]string{""}, s.graphicspath...) {
+			name := path.Join(dir, arg)
+			if cmd.ext != "" {
+				names = append(names, candidates(name, cmd.ext)...)
+			} else {
+				names = append(names, candidates(name, graphicExtensions...)...)
+			}
+		}
+		s.add(names, arg)
+	case plainFile:
+		s.add(candidates(arg, cmd.ext), arg)
+	case bibFiles:
+		for _, bib := range strings.Split(arg, ",") {
+			if bib = strings.TrimSpace(bib); bib != "" {
+				s.add(candidates(bib, ".bib"), bib)
+			}
+		}
+	case bstFile:
+		s.add(candidates(arg, ".bst"), "")
+	case styFiles:
+		for _, sty := range strings.Split(arg, ",") {
+			if sty = strings.TrimSpace(sty); sty != "" {
+				s.add([]string{sty + ".sty"}, "")
+			}
+		}
+	case clsFile:
+		s.add([]string{arg + ".cls"}, "")
+	}
+}
+
+// candidates returns the possible names of a file:
+// the name itself if it has an extension, or the name with one of the extensions.
+// An empty extension means the name as it is.
+func candidates(name string, exts ...string) []string {
+	if path.Ext(name) != "" {
+		return []string{name}
+	}
+	var names []string
+	for _, ext := range exts {
+		names = append(names, name+ext)
+	}
+	return names
+}
+
+// add adds the first existing file among names (relative to the main folder).
+// The .tex, .sty and .cls files are scanned too.
+// If none exists, missing is reported (if not empty).
+func (s *scanner) add(names []string, missing string) {
+	for _, name := range names {
+		fname := path.Join(s.dir, name)
+		if s.seen[fname] {
+			return
+		}
+		if !fs.ValidPath(fname) {
+			continue
+		}
+		data, err := fs.ReadFile(s.fsys, fname)
+		if err != nil {
+			continue
+		}
+		s.seen[fname] = true
+		s.found = append(s.found, fname)
+		switch path.Ext(fname) {
+		case ".tex", ".sty", ".cls":
+			s.scan(string(data))
+		}
+		return
+	}
+	if missing != "" && !s.seen["missing:"+missing] {
+		s.seen["missing:"+missing] = true
+		s.missing = append(s.missing, missing)
+	}
+}
+
+// StripComments removes the TeX comments (from an unescaped % to the end of the line).
+func StripComments(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if line[j] == '%' {
+				lines[i] = line[:j]
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// commandName returns the letters at the beginning of s.
+func commandName(s string) string {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// arguments returns the content of the n-th {} argument at the beginning of s,
+// skipping the optional * and [] arguments.
+func arguments(s string, n int) (string, bool) {
+	s = strings.TrimPrefix(s, "*")
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		switch {
+		case strings.HasPrefix(s, "["):
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return "", false
+			}
+			s = s[end+1:]
+		case strings.HasPrefix(s, "{"):
+			group, rest, ok := braceGroup(s)
+			if !ok {
+				return "", false
+			}
+			n--
+			if n == 0 {
+				return group, true
+			}
+			s = rest
+		default:
+			return "", false
+		}
+	}
+}
+
+// braceGroup returns the content of the {} group at the beginning of s and the rest of s.
+func braceGroup(s string) (string, string, bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[1:i], s[i+1:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// groups returns the contents of all {} groups in s (like in \graphicspath{{a/}{b/}}).
+func groups(s string) []string {
+	var list []string
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		group, rest, ok := braceGroup(s)
+		if !ok {
+			return list
+		}
+		list = append(list, strings.TrimSpace(group))
+		s = rest
+	}
+}
@@ -0,0 +1,62 @@
+package texdeps
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFind(t *testing.T) {
+	fsys := fstest.MapFS{
+		"thesis/main.tex":          {Data: []byte("not read")},
+		"thesis/mythesis.cls":      {Data: []byte("\\LoadClass{report}\n\\RequirePackage{graphicx}\n")},
+		"thesis/macros.sty":        {Data: []byte("\\input{symbols}\n")},
+		"thesis/symbols.tex":       {Data: []byte("\\newcommand\\R{\\mathbb{R}}\n")},
+		"thesis/chapters/one.tex":  {Data: []byte("\\includegraphics[width=3cm]{fig1}\n\\lstinputlisting[language=Go]{code/main.go}\n")},
+		"thesis/chapters/two.tex":  {Data: []byte("\\includegraphics{figs/ch2/fig2.png} % \\includegraphics{commented}\n")},
+		"thesis/figs/fig1.png":     {Data: []byte("png")},
+		"thesis/figs/fig1.eps":     {Data: []byte("eps")},
+		"thesis/figs/ch2/fig2.png": {Data: []byte("png")},
+		"thesis/code/main.go":      {Data: []byte("package main")},
+		"thesis/refs.bib":          {Data: []byte("@book{}")},
+		"thesis/other.bib":         {Data: []byte("@book{}")},
+		"thesis/unused.png":        {Data: []byte("png")},
+		"thesis/intro.tex":         {Data: []byte("\\input{chapters/one} % loop protection\n")},
+	}
+	main := `\documentclass[a4paper]{mythesis}
+\usepackage{amsmath,macros}
+\usepackage[utf8]{inputenc}
+\graphicspath{{figs/}{other/}}
+\begin{document}
+\input intro
+\include{chapters/one}
+\include{chapters/two}
+\include{chapters/three}
+% \input{commented}
+50\% \input{percent}
+\bibliography{refs, other}
+\end{document}
+`
+	found, missing := Find(fsys, "thesis/main.tex", []byte(main))
+	sort.Strings(found)
+	expected := []string{
+		"thesis/chapters/one.tex",
+		"thesis/chapters/two.tex",
+		"thesis/code/main.go",
+		"thesis/figs/ch2/fig2.png",
+		"thesis/figs/fig1.png",
+		"thesis/intro.tex",
+		"thesis/macros.sty",
+		"thesis/mythesis.cls",
+		"thesis/other.bib",
+		"thesis/refs.bib",
+		"thesis/symbols.tex",
+	}
+	if fmt.Sprint(found) != fmt.Sprint(expected) {
+		t.Errorf("Wrong files found:\n%v\nexpected:\n%v", found, expected)
+	}
+	if fmt.Sprint(missing) != "[chapters/three percent]" {
+		t.Errorf("Wrong missing files: %v", missing)
+	}
+}
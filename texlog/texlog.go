@@ -0,0 +1,276 @@
+// texlog package parses the logs produced by the TeX engines (pdflatex, xelatex, lualatex...).
+// It tracks the stack of the opened files to know where each message comes from,
+// and extracts:
+// - the errors (starting with "!" or in the file:line:error format) with their l.<n> line number,
+// - the undefined references and citations,
+// - the other warnings,
+// - the overfull and underfull boxes.
+package texlog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of an Entry.
+type Kind int
+
+// The following constants represent all possible entry kinds.
+const (
+	Error Kind = iota
+	Warning
+	Undefined
+	BadBox
+)
+
+// String provides the Stringer interface for Kind.
+func (k Kind) String() string {
+	switch k {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Undefined:
+		return "undefined"
+	case BadBox:
+		return "badbox"
+	}
+	return "unknown"
+}
+
+// Entry is a single message extracted from the log.
+type Entry struct {
+	Kind Kind
+	// File is the file that was processed when the message was produced (if known).
+	File string
+	// Line is the line number in File (0 if unknown).
+	Line int
+	// Message is the (single line) message.
+	Message string
+}
+
+// String provides the Stringer interface for Entry.
+// The format is file:line: message.
+func (e Entry) String() string {
+	w := new(strings.Builder)
+	if e.File != "" {
+		w.WriteString(e.File)
+		if e.Line > 0 {
+			fmt.Fprintf(w, ":%d", e.Line)
+		}
+		w.WriteString(": ")
+	} else if e.Line > 0 {
+		fmt.Fprintf(w, "line %d: ", e.Line)
+	}
+	w.WriteString(e.Message)
+	return w.String()
+}
+
+// Log contains all entries extracted from a TeX log.
+type Log struct {
+	Entries []Entry
+}
+
+// Filter returns the entries of kind k.
+func (l *Log) Filter(k Kind) []Entry {
+	var entries []Entry
+	for _, e := range l.Entries {
+		if e.Kind == k {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Summary provides a short description like "2 errors, 1 warning, 0 undefined references, 3 bad boxes".
+func (l *Log) Summary() string {
+	plural := func(n int, name string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, name)
+		}
+		if strings.HasSuffix(name, "x") {
+			return fmt.Sprintf("%d %ses", n, name)
+		}
+		return fmt.Sprintf("%d %ss", n, name)
+	}
+	return strings.Join([]string{
+		plural(len(l.Filter(Error)), "error"),
+		plural(len(l.Filter(Warning)), "warning"),
+		plural(len(l.Filter(Undefined)), "undefined reference"),
+		plural(len(l.Filter(BadBox)), "bad box"),
+	}, ", ")
+}
+
+// TeX wraps the log lines at this length (max_print_line).
+const maxPrintLine = 79
+
+// Some regular expressions used to parse the log.
+var (
+	// l.12 \foo
+	lineNumberRe = regexp.MustCompile(`^l\.(\d+)`)
+	// ./main.tex:12: Undefined control sequence.
+	fileLineErrorRe = regexp.MustCompile(`^(\.?/?[^:\s]+\.\w+):(\d+): (.*)$`)
+	// LaTeX Warning: ... / Package hyperref Warning: ... / Class article Warning: ...
+	warningRe = regexp.MustCompile(`^((?:La|pdf|Xe|Lua)?TeX(?: \w+)?|Package [\w-]+|Class [\w-]+) [Ww]arning(?: \([^)]*\))?: (.*)$`)
+	// Reference `sec:intro' on page 1 undefined / Citation `knuth' on page 1 undefined
+	undefinedRe = regexp.MustCompile("^(?:Reference|Citation) `[^']*' on page \\S+ undefined")
+	// ... on input line 12.
+	inputLineRe = regexp.MustCompile(`on input line (\d+)`)
+	// Overfull \hbox (12.0pt too wide) in paragraph at lines 10--12
+	badBoxRe = regexp.MustCompile(`^(Over|Under)full \\[hv]box .*?(?:lines? (\d+)|$)`)
+)
+
+// unwrap joins the lines that TeX has wrapped at maxPrintLine characters.
+func unwrap(log string) []string {
+	raw := strings.Split(strings.ReplaceAll(log, "\r\n", "\n"), "\n")
+	lines := make([]string, 0, len(raw))
+	wrapped := false
+	for _, line := range raw {
+		if wrapped {
+			lines[len(lines)-1] += line
+		} else {
+			lines = append(lines, line)
+		}
+		wrapped = len(line) == maxPrintLine
+	}
+	return lines
+}
+
+// parser keeps the state during the parsing.
+type parser struct {
+	// the stack of the opened files ("" for a non-file parenthesis)
+	files []string
+	log   Log
+}
+
+// file returns the current (innermost) file.
+func (p *parser) file() string {
+	for i := len(p.files) - 1; i >= 0; i-- {
+		if p.files[i] != "" {
+			return p.files[i]
+		}
+	}
+	return ""
+}
+
+// looksLikeFile checks if the name after a "(" is a file name.
+func looksLikeFile(name string) bool {
+	if name == "" {
+		return false
+	}
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "/") || strings.HasPrefix(name, "../") {
+		return true
+	}
+	ext := strings.LastIndexByte(name, '.')
+	return ext > 0 && ext < len(name)-1
+}
+
+// track updates the file stack with the parenthesis in line.
+func (p *parser) track(line string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '(':
+			end := strings.IndexAny(line[i+1:], " ()\t")
+			if end < 0 {
+				end = len(line) - i - 1
+			}
+			name := line[i+1 : i+1+end]
+			if looksLikeFile(name) {
+				p.files = append(p.files, strings.TrimPrefix(name, "./"))
+				i += end
+			} else {
+				p.files = append(p.files, "")
+			}
+		case ')':
+			if len(p.files) > 0 {
+				p.files = p.files[:len(p.files)-1]
+			}
+		}
+	}
+}
+
+// add appends a new entry.
+func (p *parser) add(k Kind, file string, line int, msg string) {
+	p.log.Entries = append(p.log.Entries, Entry{Kind: k, File: file, Line: line, Message: strings.TrimSpace(msg)})
+}
+
+// Parse extracts the errors, the warnings and the bad boxes from a TeX log.
+func Parse(log string) *Log {
+	p := new(parser)
+	lines := unwrap(log)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "! "):
+			// error: look for the l.<n> line in the following lines
+			msg, num := line[2:], 0
+			for j := i + 1; j < len(lines) && j <= i+maxErrorLines; j++ {
+				if m := lineNumberRe.FindStringSubmatch(lines[j]); m != nil {
+					num, _ = strconv.Atoi(m[1])
+					i = j
+					break
+				}
+				if strings.HasPrefix(lines[j], "! ") {
+					break
+				}
+			}
+			p.add(Error, p.file(), num, msg)
+		case fileLineErrorRe.MatchString(line):
+			m := fileLineErrorRe.FindStringSubmatch(line)
+			num, _ := strconv.Atoi(m[2])
+			p.add(Error, strings.TrimPrefix(m[1], "./"), num, m[3])
+			// skip the context up to the l.<n> line
+			for j := i + 1; j < len(lines) && j <= i+maxErrorLines; j++ {
+				if lineNumberRe.MatchString(lines[j]) {
+					i = j
+					break
+				}
+			}
+		case warningRe.MatchString(line):
+			m := warningRe.FindStringSubmatch(line)
+			msg := m[2]
+			// the message continues on the lines starting with "(package)" or spaces
+			prefix := "(" + packageName(m[1]) + ")"
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1], prefix) {
+				i++
+				msg += " " + strings.TrimSpace(strings.TrimPrefix(lines[i], prefix))
+			}
+			num := 0
+			if n := inputLineRe.FindStringSubmatch(msg); n != nil {
+				num, _ = strconv.Atoi(n[1])
+			}
+			kind := Warning
+			if undefinedRe.MatchString(msg) {
+				kind = Undefined
+			}
+			p.add(kind, p.file(), num, msg)
+			p.track(line)
+		case badBoxRe.MatchString(line):
+			m := badBoxRe.FindStringSubmatch(line)
+			num, _ := strconv.Atoi(m[2])
+			p.add(BadBox, p.file(), num, line)
+			// the box content is printed after (up to an empty line), and can contain any parenthesis
+			for j := i + 1; j < len(lines) && j <= i+maxErrorLines; j++ {
+				if lines[j] == "" {
+					i = j
+					break
+				}
+			}
+		default:
+			p.track(line)
+		}
+	}
+	return &p.log
+}
+
+// An error context is never longer than this number of lines.
+const maxErrorLines = 20
+
+// packageName returns the name used in the continuation lines,
+// like "hyperref" for "Package hyperref" or "Font" for "LaTeX Font".
+func packageName(origin string) string {
+	fields := strings.Fields(origin)
+	return fields[len(fields)-1]
+}
@@ -0,0 +1,88 @@
+package texlog
+
+import (
+	"testing"
+)
+
+const testLog = `This is pdfTeX, Version 3.141592653-2.6-1.40.25 (TeX Live 2023) (preloaded format=pdflatex)
+entering extended mode
+(./main.tex
+LaTeX2e <2022-11-01> patch level 1
+(/usr/share/texlive/texmf-dist/tex/latex/base/article.cls
+Document Class: article 2022/07/02 v1.4n Standard LaTeX document class
+(/usr/share/texlive/texmf-dist/tex/latex/base/size10.clo))
+(./main.aux) (./chapter1.tex
+! Undefined control sequence.
+l.12 \foo
+         
+Overfull \hbox (12.0pt too wide) in paragraph at lines 20--22
+[]\OT1/cmr/m/n/10 Some (text
+ []
+
+)
+
+LaTeX Warning: Reference ` + "`sec:intro'" + ` on page 1 undefined on input line 30.
+
+
+Package hyperref Warning: Token not allowed in a PDF string (Unicode):
+(hyperref)                removing ` + "`math shift'" + ` on input line 31.
+
+! LaTeX Error: File ` + "`missing.sty'" + ` not found.
+
+Type X to quit or <RETURN> to proceed,
+or enter new name. (Default extension: sty)
+
+Enter file name: 
+! Emergency stop.
+<read *> 
+         
+l.40 \usepackage
+                {missing}^^M
+)
+`
+
+func TestParse(t *testing.T) {
+	log := Parse(testLog)
+
+	expected := []Entry{
+		{Error, "chapter1.tex", 12, "Undefined control sequence."},
+		{BadBox, "chapter1.tex", 20, `Overfull \hbox (12.0pt too wide) in paragraph at lines 20--22`},
+		{Undefined, "main.tex", 30, "Reference `sec:intro' on page 1 undefined on input line 30."},
+		{Warning, "main.tex", 31, "Token not allowed in a PDF string (Unicode): removing `math shift' on input line 31."},
+		{Error, "main.tex", 0, "LaTeX Error: File `missing.sty' not found."},
+		{Error, "main.tex", 40, "Emergency stop."},
+	}
+	if len(log.Entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d:\n%v", len(expected), len(log.Entries), log.Entries)
+	}
+	for i, e := range expected {
+		if log.Entries[i] != e {
+			t.Errorf("Entry %d:\nexpected %#v\ngot      %#v", i, e, log.Entries[i])
+		}
+	}
+	if s := log.Summary(); s != "3 errors, 1 warning, 1 undefined reference, 1 bad box" {
+		t.Errorf("Wrong summary: %s", s)
+	}
+}
+
+func TestFileLineError(t *testing.T) {
+	log := Parse("(./main.tex\n./main.tex:7: Undefined control sequence.\nl.7 \\foo\n)\n")
+	if len(log.Entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %v", log.Entries)
+	}
+	if s := log.Entries[0].String(); s != "main.tex:7: Undefined control sequence." {
+		t.Errorf("Wrong entry: %s", s)
+	}
+}
+
+func TestSummaryPlural(t *testing.T) {
+	log := &Log{Entries: []Entry{
+		{Kind: BadBox, Message: `Overfull \hbox`},
+		{Kind: BadBox, Message: `Underfull \vbox`},
+		{Kind: Undefined, Message: "Citation undefined"},
+		{Kind: Undefined, Message: "Reference undefined"},
+	}}
+	if s := log.Summary(); s != "0 errors, 0 warnings, 2 undefined references, 2 bad boxes" {
+		t.Errorf("Wrong summary: %s", s)
+	}
+}